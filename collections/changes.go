@@ -0,0 +1,114 @@
+package collections
+
+import (
+	"fmt"
+	"io"
+
+	"pocketforge/config"
+)
+
+type ChangeAction string
+
+const (
+	ChangeCreate ChangeAction = "create"
+	ChangeUpdate ChangeAction = "update"
+	ChangeDelete ChangeAction = "delete"
+)
+
+// Change describes a single modification made (or planned) while reconciling
+// the collections configuration with the database.
+type Change struct {
+	Action     ChangeAction
+	Kind       string
+	Collection string
+	Name       string
+	Detail     string
+
+	// Data is set when the change updates stored records rather than the
+	// collections, so it cannot be reproduced by a collections migration.
+	Data bool
+}
+
+func (c Change) String() string {
+	target := c.Collection
+	if c.Name != "" {
+		target = c.Collection + "." + c.Name
+	}
+
+	if c.Detail == "" {
+		return config.Redact(fmt.Sprintf("%s %s %s", c.Action, c.Kind, target))
+	}
+	return config.Redact(fmt.Sprintf("%s %s %s (%s)", c.Action, c.Kind, target, c.Detail))
+}
+
+// ChangeLog collects the changes made during a reconciliation run. A nil
+// ChangeLog is valid and records nothing.
+type ChangeLog struct {
+	Changes []Change
+
+	// DryRun is set when the changes are only being planned and will be
+	// rolled back, so side effects outside the database (such as binding
+	// hooks) must be skipped.
+	DryRun bool
+}
+
+func (changes *ChangeLog) record(action ChangeAction, kind string, collection string, name string, detail string) {
+	if changes == nil {
+		return
+	}
+
+	changes.Changes = append(changes.Changes, Change{
+		Action:     action,
+		Kind:       kind,
+		Collection: collection,
+		Name:       name,
+		Detail:     detail,
+	})
+}
+
+// recordData records a change that updates stored records.
+func (changes *ChangeLog) recordData(action ChangeAction, kind string, collection string, name string, detail string) {
+	changes.record(action, kind, collection, name, detail)
+	if changes != nil {
+		changes.Changes[len(changes.Changes)-1].Data = true
+	}
+}
+
+// dataChanges returns the changes that update stored records.
+func (changes *ChangeLog) dataChanges() []Change {
+	if changes == nil {
+		return nil
+	}
+
+	var data []Change
+	for _, change := range changes.Changes {
+		if change.Data {
+			data = append(data, change)
+		}
+	}
+	return data
+}
+
+func (changes *ChangeLog) isDryRun() bool {
+	return changes != nil && changes.DryRun
+}
+
+// Print writes a human readable summary of the changes to w.
+func (changes *ChangeLog) Print(w io.Writer) {
+	if changes == nil || len(changes.Changes) == 0 {
+		fmt.Fprintln(w, "No changes.")
+		return
+	}
+
+	symbols := map[ChangeAction]string{
+		ChangeCreate: "+",
+		ChangeUpdate: "~",
+		ChangeDelete: "-",
+	}
+
+	for _, change := range changes.Changes {
+		fmt.Fprintf(w, "%s %s\n", symbols[change.Action], change)
+	}
+
+	fmt.Fprintf(w, "\n%d change(s).\n", len(changes.Changes))
+}
@@ -1,107 +1,188 @@
 package collections
 
 import (
-	"log"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
 
-	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/spf13/viper"
+
+	"pocketforge/config"
 )
 
 type EmailTemplateConfig struct {
-	Subject string `mapstructure:"subject" json:"subject"`
-	Body    string `mapstructure:"body" json:"body"`
+	Subject  string `mapstructure:"subject" json:"subject,omitempty"`
+	Body     string `mapstructure:"body" json:"body,omitempty"`
+	BodyFile string `mapstructure:"body_file" json:"body_file,omitempty"`
+	TextFile string `mapstructure:"text_file" json:"text_file,omitempty"`
 }
 
 type AuthAlertConfig struct {
 	Enabled       bool                `mapstructure:"enabled" json:"enabled"`
-	EmailTemplate EmailTemplateConfig `mapstructure:"email_template" json:"email_template"`
+	EmailTemplate EmailTemplateConfig `mapstructure:"email_template" json:"email_template,omitempty"`
 }
 
 type TokenConfig struct {
-	Duration int `mapstructure:"duration" json:"duration"`
+	Duration int `mapstructure:"duration" json:"duration,omitempty"`
 }
 
 type MFAConfig struct {
 	Enabled  bool   `mapstructure:"enabled" json:"enabled"`
-	Duration int    `mapstructure:"duration" json:"duration"`
-	Rule     string `mapstructure:"rule" json:"rule"`
+	Duration int    `mapstructure:"duration" json:"duration,omitempty"`
+	Rule     string `mapstructure:"rule" json:"rule,omitempty"`
 }
 
 type OTPConfig struct {
 	Enabled       bool                `mapstructure:"enabled" json:"enabled"`
-	Duration      int                 `mapstructure:"duration" json:"duration"`
-	Length        int                 `mapstructure:"length" json:"length"`
-	EmailTemplate EmailTemplateConfig `mapstructure:"email_template" json:"email_template"`
+	Duration      int                 `mapstructure:"duration" json:"duration,omitempty"`
+	Length        int                 `mapstructure:"length" json:"length,omitempty"`
+	EmailTemplate EmailTemplateConfig `mapstructure:"email_template" json:"email_template,omitempty"`
 }
 
 type PasswordConfig struct {
 	Enabled        bool     `mapstructure:"enabled" json:"enabled"`
-	IdentityFields []string `mapstructure:"identity_fields" json:"identity_fields"`
+	IdentityFields []string `mapstructure:"identity_fields" json:"identity_fields,omitempty"`
 }
 
 type OAuth2ProviderConfig struct {
-	PKCE *bool `mapstructure:"pkce,omitempty" json:"pkce"`
+	PKCE *bool `mapstructure:"pkce,omitempty" json:"pkce,omitempty"`
+
+	Name             string         `mapstructure:"name" json:"name,omitempty"`
+	ClientId         string         `mapstructure:"client_id" json:"client_id,omitempty"`
+	ClientSecret     string         `mapstructure:"client_secret,omitempty" json:"client_secret,omitempty"`
+	ClientSecretEnv  string         `mapstructure:"client_secret_env,omitempty" json:"client_secret_env,omitempty"`
+	ClientSecretFile string         `mapstructure:"client_secret_file,omitempty" json:"client_secret_file,omitempty"`
+	AuthURL          string         `mapstructure:"auth_url,omitempty" json:"auth_url,omitempty"`
+	TokenURL         string         `mapstructure:"token_url,omitempty" json:"token_url,omitempty"`
+	UserInfoURL      string         `mapstructure:"user_info_url,omitempty" json:"user_info_url,omitempty"`
+	DisplayName      string         `mapstructure:"display_name,omitempty" json:"display_name,omitempty"`
+	Extra            map[string]any `mapstructure:"extra,omitempty" json:"extra,omitempty"`
+}
+
+// clientSecret returns the client secret of the provider, read from the
+// configuration, an environment variable or a file.
+func (provider *OAuth2ProviderConfig) clientSecret() (string, error) {
+	sources := 0
+	for _, source := range []string{provider.ClientSecret, provider.ClientSecretEnv, provider.ClientSecretFile} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return "", fmt.Errorf("provider %s: only one of client_secret, client_secret_env and client_secret_file can be set", provider.Name)
+	}
 
-	Name         string         `mapstructure:"name" json:"name"`
-	ClientId     string         `mapstructure:"client_id" json:"client_id"`
-	ClientSecret string         `mapstructure:"client_secret,omitempty" json:"client_secret,omitempty"`
-	AuthURL      string         `mapstructure:"auth_url,omitempty" json:"auth_url"`
-	TokenURL     string         `mapstructure:"token_url,omitempty" json:"token_url"`
-	UserInfoURL  string         `mapstructure:"user_info_url,omitempty" json:"user_info_url"`
-	DisplayName  string         `mapstructure:"display_name,omitempty" json:"display_name"`
-	Extra        map[string]any `mapstructure:"extra,omitempty" json:"extra"`
+	switch {
+	case provider.ClientSecretEnv != "":
+		secret, ok := os.LookupEnv(provider.ClientSecretEnv)
+		if !ok || secret == "" {
+			return "", fmt.Errorf("provider %s: environment variable %s is not set", provider.Name, provider.ClientSecretEnv)
+		}
+		config.AddSecret(secret)
+		return secret, nil
+	case provider.ClientSecretFile != "":
+		secret, err := os.ReadFile(config.ResolvePath(provider.ClientSecretFile))
+		if err != nil {
+			return "", fmt.Errorf("provider %s: failed to read client secret file: %w", provider.Name, err)
+		}
+		// Secret files usually end with a newline.
+		resolved := strings.TrimSpace(string(secret))
+		if resolved == "" {
+			return "", fmt.Errorf("provider %s: client secret file %s is empty", provider.Name, provider.ClientSecretFile)
+		}
+		config.AddSecret(resolved)
+		return resolved, nil
+	default:
+		config.AddSecret(provider.ClientSecret)
+		return provider.ClientSecret, nil
+	}
+}
+
+// clientSecretEnvName returns the environment variable suggested for the
+// client secret of the provider, such as USERS_GOOGLE_CLIENT_SECRET.
+func clientSecretEnvName(collection string, provider string) string {
+	name := migrationNamePattern.ReplaceAllString(collection+"_"+provider, "_")
+	return strings.ToUpper(name) + "_CLIENT_SECRET"
+}
+
+// toCore converts the provider configuration to the PocketBase provider settings.
+func (provider *OAuth2ProviderConfig) toCore() (core.OAuth2ProviderConfig, error) {
+	secret, err := provider.clientSecret()
+	if err != nil {
+		return core.OAuth2ProviderConfig{}, err
+	}
+
+	return core.OAuth2ProviderConfig{
+		PKCE:         provider.PKCE,
+		Name:         provider.Name,
+		ClientId:     provider.ClientId,
+		ClientSecret: secret,
+		AuthURL:      provider.AuthURL,
+		TokenURL:     provider.TokenURL,
+		UserInfoURL:  provider.UserInfoURL,
+		DisplayName:  provider.DisplayName,
+		Extra:        provider.Extra,
+	}, nil
 }
 
 type OAuth2MappedFieldConfig struct {
-	AvatarURL string `mapstructure:"avatar_url" json:"avatar_url"`
-	Id        string `mapstructure:"id" json:"id"`
-	Name      string `mapstructure:"name" json:"name"`
-	Username  string `mapstructure:"username" json:"username"`
+	AvatarURL string `mapstructure:"avatar_url" json:"avatar_url,omitempty"`
+	Id        string `mapstructure:"id" json:"id,omitempty"`
+	Name      string `mapstructure:"name" json:"name,omitempty"`
+	Username  string `mapstructure:"username" json:"username,omitempty"`
 }
 
 type OAuth2Config struct {
 	Enabled      bool                    `mapstructure:"enabled" json:"enabled"`
-	MappedFields OAuth2MappedFieldConfig `mapstructure:"mapped_fields" json:"mapped_fields"`
-	Providers    []OAuth2ProviderConfig  `mapstructure:"providers" json:"providers"`
+	MappedFields OAuth2MappedFieldConfig `mapstructure:"mapped_fields" json:"mapped_fields,omitempty"`
+	Providers    []OAuth2ProviderConfig  `mapstructure:"providers" json:"providers,omitempty"`
 }
 
 type AuthConfig struct {
-	AuthAlert                  AuthAlertConfig     `mapstructure:"auth_alert" json:"auth_alert"`
-	AuthToken                  TokenConfig         `mapstructure:"auth_token" json:"auth_token"`
-	ConfirmEmailChangeTemplate EmailTemplateConfig `mapstructure:"confirm_email_change_template" json:"confirm_email_change_template"`
-	EmailChangeToken           TokenConfig         `mapstructure:"email_change_token" json:"email_change_token"`
-	FileToken                  TokenConfig         `mapstructure:"file_token" json:"file_token"`
-	MFA                        MFAConfig           `mapstructure:"mfa" json:"mfa"`
-	OTP                        OTPConfig           `mapstructure:"otp" json:"otp"`
-	PasswordAuth               PasswordConfig      `mapstructure:"password_auth" json:"password_auth"`
-	PasswordResetToken         TokenConfig         `mapstructure:"password_reset_token" json:"password_reset_token"`
-	ResetPasswordTemplate      EmailTemplateConfig `mapstructure:"reset_pasword_template" json:"reset_pasword_template"`
-	VerificationTemplate       EmailTemplateConfig `mapstructure:"verification_template" json:"verification_template"`
-	VerificationToken          TokenConfig         `mapstructure:"verification_token" json:"verification_token"`
-	OAuth2                     OAuth2Config        `mapstructure:"oauth" json:"oauth"`
+	AuthAlert                  AuthAlertConfig     `mapstructure:"auth_alert" json:"auth_alert,omitempty"`
+	AuthToken                  TokenConfig         `mapstructure:"auth_token" json:"auth_token,omitempty"`
+	ConfirmEmailChangeTemplate EmailTemplateConfig `mapstructure:"confirm_email_change_template" json:"confirm_email_change_template,omitempty"`
+	EmailChangeToken           TokenConfig         `mapstructure:"email_change_token" json:"email_change_token,omitempty"`
+	FileToken                  TokenConfig         `mapstructure:"file_token" json:"file_token,omitempty"`
+	MFA                        MFAConfig           `mapstructure:"mfa" json:"mfa,omitempty"`
+	OTP                        OTPConfig           `mapstructure:"otp" json:"otp,omitempty"`
+	PasswordAuth               PasswordConfig      `mapstructure:"password_auth" json:"password_auth,omitempty"`
+	PasswordResetToken         TokenConfig         `mapstructure:"password_reset_token" json:"password_reset_token,omitempty"`
+	ResetPasswordTemplate      EmailTemplateConfig `mapstructure:"reset_pasword_template" json:"reset_pasword_template,omitempty"`
+	VerificationTemplate       EmailTemplateConfig `mapstructure:"verification_template" json:"verification_template,omitempty"`
+	VerificationToken          TokenConfig         `mapstructure:"verification_token" json:"verification_token,omitempty"`
+	OAuth2                     OAuth2Config        `mapstructure:"oauth" json:"oauth,omitempty"`
 }
 
 type AuthConfigAction struct {
 	AuthConfig  AuthConfig
 	TableConfig *CollectionConfig
 	V           *viper.Viper
-	App         *pocketbase.PocketBase
+	App         core.App
 }
 
-func (configuration *CollectionConfig) ConfigAuth(app *pocketbase.PocketBase, v *viper.Viper) {
+func (configuration *CollectionConfig) ConfigAuth(app core.App, v *viper.Viper) error {
+
+	// No auth section was configured, so the collection keeps its current settings.
+	if v == nil {
+		return nil
+	}
 
 	_, err := configuration.refreshCollection(app)
 	if err != nil {
-		log.Panicf("Auth Collection %s not found", configuration.Name)
+		return fmt.Errorf("auth collection not found: %w", err)
 	}
 
-	if configuration.collection == nil {
-		log.Panicf("Auth Collection %s not found", configuration.Name)
+	if configuration.collection.Type != "auth" {
+		return fmt.Errorf("collection %s is not an auth collection", configuration.Name)
 	}
 
-	if configuration.collection.Type != "auth" {
-		log.Panicf("Collection %s is not an auth collection", configuration.Name)
+	before, err := json.Marshal(configuration.collection)
+	if err != nil {
+		return fmt.Errorf("failed to serialise auth collection: %w", err)
 	}
 
 	// Auth Alert
@@ -149,6 +230,11 @@ func (configuration *CollectionConfig) ConfigAuth(app *pocketbase.PocketBase, v
 	processAuthStringItem(v, "verification_template.subject", &configuration.collection.VerificationTemplate.Subject)
 	processAuthStringItem(v, "verification_template.body", &configuration.collection.VerificationTemplate.Body)
 
+	// Email Template Files
+	if err := configuration.loadEmailTemplateFiles(v); err != nil {
+		return err
+	}
+
 	// Verification Token
 	processAuthInt64Item(v, "verification_token.duration", &configuration.collection.VerificationToken.Duration)
 
@@ -161,16 +247,63 @@ func (configuration *CollectionConfig) ConfigAuth(app *pocketbase.PocketBase, v
 
 	// Oauth Providers
 	if v.IsSet("oauth.providers") {
-		var providers []core.OAuth2ProviderConfig
-		err := v.UnmarshalKey("oauth.providers", &providers)
+		var providerConfigs []OAuth2ProviderConfig
+		err := v.UnmarshalKey("oauth.providers", &providerConfigs)
 		if err != nil {
-			log.Panicf("Failed to unmarshal oauth providers: %v", err)
+			return fmt.Errorf("failed to read oauth providers: %w", err)
+		}
+
+		providers := make([]core.OAuth2ProviderConfig, 0, len(providerConfigs))
+		for i := range providerConfigs {
+			provider, err := providerConfigs[i].toCore()
+			if err != nil {
+				return err
+			}
+			providers = append(providers, provider)
 		}
 		configuration.collection.OAuth2.Providers = providers
 	}
 
-	configuration.saveAndRefreshCollection(app)
+	after, err := json.Marshal(configuration.collection)
+	if err != nil {
+		return fmt.Errorf("failed to serialise auth collection: %w", err)
+	}
+
+	if changed := changedKeys(before, after); len(changed) > 0 {
+		configuration.changes.record(ChangeUpdate, "auth", configuration.Name, "", strings.Join(changed, ", "))
+		if _, err := configuration.saveAndRefreshCollection(app); err != nil {
+			return fmt.Errorf("failed to save auth settings: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// changedKeys returns the sorted top level keys whose values differ between
+// two JSON objects.
+func changedKeys(before []byte, after []byte) []string {
+	var beforeMap, afterMap map[string]json.RawMessage
+	if err := json.Unmarshal(before, &beforeMap); err != nil {
+		return []string{"*"}
+	}
+	if err := json.Unmarshal(after, &afterMap); err != nil {
+		return []string{"*"}
+	}
+
+	var changed []string
+	for key, value := range afterMap {
+		if string(beforeMap[key]) != string(value) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range beforeMap {
+		if _, ok := afterMap[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
 
+	sort.Strings(changed)
+	return changed
 }
 
 func processAuthStringItem(v *viper.Viper, key string, value *string) {
@@ -0,0 +1,291 @@
+package collections
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/viper"
+
+	"pocketforge/config"
+)
+
+// emailTemplateKeys are the configuration keys of the email templates of an
+// auth collection.
+var emailTemplateKeys = []string{
+	"auth_alert.email_template",
+	"confirm_email_change_template",
+	"otp.email_template",
+	"reset_pasword_template",
+	"verification_template",
+}
+
+// emailTemplate returns the email template of the collection for a key of
+// emailTemplateKeys.
+func emailTemplate(collection *core.Collection, key string) *core.EmailTemplate {
+	switch key {
+	case "auth_alert.email_template":
+		return &collection.AuthAlert.EmailTemplate
+	case "confirm_email_change_template":
+		return &collection.ConfirmEmailChangeTemplate
+	case "otp.email_template":
+		return &collection.OTP.EmailTemplate
+	case "reset_pasword_template":
+		return &collection.ResetPasswordTemplate
+	case "verification_template":
+		return &collection.VerificationTemplate
+	default:
+		return nil
+	}
+}
+
+// emailTemplateFile is an email template with its HTML body or plain text
+// alternative loaded from files.
+type emailTemplateFile struct {
+	collectionId string
+	key          string
+	bodyFile     string
+	textFile     string
+}
+
+// emailTemplateFiles holds the template files of every auth collection, keyed
+// by collection id and template key. They are used to reload changed body
+// files, and to add the plain text alternative when an email is sent.
+var emailTemplateFiles = struct {
+	sync.RWMutex
+	files map[string]emailTemplateFile
+}{files: map[string]emailTemplateFile{}}
+
+func emailTemplateFileKey(collectionId string, key string) string {
+	return collectionId + "/" + key
+}
+
+// loadEmailTemplateFiles sets the body of each email template with a body_file
+// from the file, and registers the template files of the collection.
+func (configuration *CollectionConfig) loadEmailTemplateFiles(v *viper.Viper) error {
+
+	for _, key := range emailTemplateKeys {
+		templateFile := emailTemplateFile{
+			collectionId: configuration.collection.Id,
+			key:          key,
+			bodyFile:     config.ResolvePath(v.GetString(key + ".body_file")),
+			textFile:     config.ResolvePath(v.GetString(key + ".text_file")),
+		}
+
+		fileKey := emailTemplateFileKey(templateFile.collectionId, key)
+
+		// A planned configuration is only checked, as the running server
+		// keeps using its own template files.
+		dryRun := configuration.changes.isDryRun()
+
+		if templateFile.bodyFile == "" && templateFile.textFile == "" {
+			if !dryRun {
+				emailTemplateFiles.Lock()
+				delete(emailTemplateFiles.files, fileKey)
+				emailTemplateFiles.Unlock()
+			}
+			continue
+		}
+
+		if templateFile.bodyFile != "" {
+			if v.IsSet(key + ".body") {
+				return fmt.Errorf("%s: only one of body and body_file can be set", key)
+			}
+
+			body, err := os.ReadFile(templateFile.bodyFile)
+			if err != nil {
+				return fmt.Errorf("%s: failed to read body file: %w", key, err)
+			}
+			emailTemplate(configuration.collection, key).Body = string(body)
+		}
+
+		if templateFile.textFile != "" {
+			if _, err := os.Stat(templateFile.textFile); err != nil {
+				return fmt.Errorf("%s: failed to read text file: %w", key, err)
+			}
+		}
+
+		if !dryRun {
+			emailTemplateFiles.Lock()
+			emailTemplateFiles.files[fileKey] = templateFile
+			emailTemplateFiles.Unlock()
+		}
+	}
+
+	return nil
+}
+
+// bindEmailTemplateText adds the plain text alternative from the text_file of
+// each template to the emails sent with it. The file is read as each email is
+// sent, so changes apply immediately.
+func bindEmailTemplateText(app core.App) {
+	bind := func(key string) func(e *core.MailerRecordEvent) error {
+		return func(e *core.MailerRecordEvent) error {
+			if err := setEmailText(e, key); err != nil {
+				return err
+			}
+			return e.Next()
+		}
+	}
+
+	app.OnMailerRecordAuthAlertSend().BindFunc(bind("auth_alert.email_template"))
+	app.OnMailerRecordEmailChangeSend().BindFunc(bind("confirm_email_change_template"))
+	app.OnMailerRecordOTPSend().BindFunc(bind("otp.email_template"))
+	app.OnMailerRecordPasswordResetSend().BindFunc(bind("reset_pasword_template"))
+	app.OnMailerRecordVerificationSend().BindFunc(bind("verification_template"))
+}
+
+func setEmailText(e *core.MailerRecordEvent, key string) error {
+	if e.Record == nil {
+		return nil
+	}
+
+	emailTemplateFiles.RLock()
+	templateFile, ok := emailTemplateFiles.files[emailTemplateFileKey(e.Record.Collection().Id, key)]
+	emailTemplateFiles.RUnlock()
+
+	if !ok || templateFile.textFile == "" {
+		return nil
+	}
+
+	text, err := os.ReadFile(templateFile.textFile)
+	if err != nil {
+		return fmt.Errorf("failed to read email text file: %w", err)
+	}
+
+	_, e.Message.Text = core.EmailTemplate{Body: string(text)}.Resolve(emailPlaceholders(e))
+	return nil
+}
+
+// emailPlaceholders returns the values of the placeholders PocketBase resolves
+// in email templates, so that they can be used in plain text alternatives.
+func emailPlaceholders(e *core.MailerRecordEvent) map[string]any {
+	placeholders := map[string]any{
+		core.EmailPlaceholderAppName: e.App.Settings().Meta.AppName,
+		core.EmailPlaceholderAppURL:  e.App.Settings().Meta.AppURL,
+	}
+
+	metaPlaceholders := map[string]string{
+		"token":    core.EmailPlaceholderToken,
+		"password": core.EmailPlaceholderOTP,
+		"otpId":    core.EmailPlaceholderOTPId,
+		"info":     core.EmailPlaceholderAlertInfo,
+	}
+	for metaKey, placeholder := range metaPlaceholders {
+		if value, ok := e.Meta[metaKey]; ok {
+			placeholders[placeholder] = value
+		}
+	}
+
+	for _, field := range e.Record.Collection().Fields {
+		if !field.GetHidden() {
+			placeholders["{RECORD:"+field.GetName()+"}"] = e.Record.Get(field.GetName())
+		}
+	}
+
+	return placeholders
+}
+
+// watchEmailTemplates reloads the body of an email template into its
+// collection when its body file changes. The directories of the files are
+// watched, as editors often replace a file rather than writing to it.
+func watchEmailTemplates(app core.App) (*fsnotify.Watcher, error) {
+
+	emailTemplateFiles.RLock()
+	directories := map[string]bool{}
+	for _, templateFile := range emailTemplateFiles.files {
+		if templateFile.bodyFile != "" {
+			directories[filepath.Dir(templateFile.bodyFile)] = true
+		}
+	}
+	emailTemplateFiles.RUnlock()
+
+	if len(directories) == 0 {
+		return nil, nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	for directory := range directories {
+		if err := watcher.Add(directory); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+					continue
+				}
+				if err := reloadEmailTemplates(app, event.Name); err != nil {
+					app.Logger().Error("Failed to reload email template", "file", event.Name, "error", err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				app.Logger().Error("Email template watcher error", "error", err)
+			}
+		}
+	}()
+
+	return watcher, nil
+}
+
+// reloadEmailTemplates updates the body of every template using the file.
+func reloadEmailTemplates(app core.App, path string) error {
+
+	emailTemplateFiles.RLock()
+	var templateFiles []emailTemplateFile
+	for _, templateFile := range emailTemplateFiles.files {
+		if templateFile.bodyFile != "" && filepath.Clean(templateFile.bodyFile) == filepath.Clean(path) {
+			templateFiles = append(templateFiles, templateFile)
+		}
+	}
+	emailTemplateFiles.RUnlock()
+
+	if len(templateFiles) == 0 {
+		return nil
+	}
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, templateFile := range templateFiles {
+		collection, err := app.FindCollectionByNameOrId(templateFile.collectionId)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		template := emailTemplate(collection, templateFile.key)
+		if template.Body == string(body) {
+			continue
+		}
+
+		template.Body = string(body)
+		if err := app.Save(collection); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save %s: %w", collection.Name, err))
+			continue
+		}
+		app.Logger().Info("Reloaded email template", "collection", collection.Name, "template", templateFile.key)
+	}
+
+	return errors.Join(errs...)
+}
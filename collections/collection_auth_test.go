@@ -0,0 +1,61 @@
+package collections
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pocketforge/config"
+)
+
+func TestOAuth2ProviderClientSecret(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretFile, []byte("file-client-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, []byte(" \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_OAUTH2_CLIENT_SECRET", "env-client-secret")
+	t.Setenv("TEST_OAUTH2_EMPTY_SECRET", "")
+
+	tests := []struct {
+		name     string
+		provider OAuth2ProviderConfig
+		want     string
+		wantErr  bool
+	}{
+		{name: "inline", provider: OAuth2ProviderConfig{ClientSecret: "inline-client-secret"}, want: "inline-client-secret"},
+		{name: "env", provider: OAuth2ProviderConfig{ClientSecretEnv: "TEST_OAUTH2_CLIENT_SECRET"}, want: "env-client-secret"},
+		{name: "file", provider: OAuth2ProviderConfig{ClientSecretFile: secretFile}, want: "file-client-secret"},
+		{name: "empty env", provider: OAuth2ProviderConfig{ClientSecretEnv: "TEST_OAUTH2_EMPTY_SECRET"}, wantErr: true},
+		{name: "unset env", provider: OAuth2ProviderConfig{ClientSecretEnv: "TEST_OAUTH2_UNSET_SECRET"}, wantErr: true},
+		{name: "empty file", provider: OAuth2ProviderConfig{ClientSecretFile: emptyFile}, wantErr: true},
+		{name: "missing file", provider: OAuth2ProviderConfig{ClientSecretFile: filepath.Join(dir, "missing")}, wantErr: true},
+		{name: "two sources", provider: OAuth2ProviderConfig{ClientSecret: "inline-client-secret", ClientSecretFile: secretFile}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.provider.Name = "test"
+			got, err := test.provider.clientSecret()
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("clientSecret() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("clientSecret() = %q, want %q", got, test.want)
+			}
+			if redacted := config.Redact("secret: " + got); redacted != "secret: [redacted]" {
+				t.Errorf("the client secret is not redacted: %s", redacted)
+			}
+		})
+	}
+}
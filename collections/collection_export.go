@@ -0,0 +1,424 @@
+package collections
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/dbutils"
+	"gopkg.in/yaml.v3"
+)
+
+// ExportCollections builds a collections configuration matching every non-system
+// collection currently in the database.
+func ExportCollections(app core.App) (*CollectionPluginConfig, error) {
+
+	collections, err := app.FindAllCollections()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find collections: %v", err)
+	}
+
+	pluginConfig := &CollectionPluginConfig{
+		Enabled: true,
+	}
+
+	for _, collection := range collections {
+		if collection.System {
+			continue
+		}
+		pluginConfig.Collections = append(pluginConfig.Collections, exportCollection(collection))
+	}
+
+	// Relations refer to collections by name, so the config does not depend on generated ids.
+	names := map[string]string{}
+	for _, collection := range collections {
+		names[collection.Id] = collection.Name
+	}
+	for i := range pluginConfig.Collections {
+		fields := pluginConfig.Collections[i].Fields
+		for j := range fields {
+			if name, ok := names[fields[j].CollectionId]; ok {
+				fields[j].Collection = name
+				fields[j].CollectionId = ""
+			}
+		}
+	}
+
+	return pluginConfig, nil
+}
+
+// MarshalCollectionsConfig renders the configuration under a top level
+// "collections" key, ready to be placed in a config file of the given format.
+func MarshalCollectionsConfig(pluginConfig *CollectionPluginConfig, format string) ([]byte, error) {
+
+	jsonBytes, err := json.Marshal(map[string]any{"collections": pluginConfig})
+	if err != nil {
+		return nil, err
+	}
+
+	var tree map[string]any
+	if err := json.Unmarshal(jsonBytes, &tree); err != nil {
+		return nil, err
+	}
+	pruneEmpty(tree)
+	writeDefaultFieldsFlag(tree)
+
+	switch format {
+	case "json":
+		return json.MarshalIndent(tree, "", "  ")
+	case "yaml":
+		var buffer bytes.Buffer
+		encoder := yaml.NewEncoder(&buffer)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(tree); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	case "toml":
+		return toml.Marshal(tree)
+	default:
+		return nil, fmt.Errorf("unknown export format %s", format)
+	}
+}
+
+// writeDefaultFieldsFlag writes add_default_fields: false for the collections
+// it applies to, as the schema documents it as true when it is not set.
+func writeDefaultFieldsFlag(tree map[string]any) {
+	pluginTree, _ := tree["collections"].(map[string]any)
+	collections, _ := pluginTree["collections"].([]any)
+
+	for _, item := range collections {
+		collection, ok := item.(map[string]any)
+		if !ok || collection["type"] == "view" {
+			continue
+		}
+		if _, ok := collection["add_default_fields"]; !ok {
+			collection["add_default_fields"] = false
+		}
+	}
+}
+
+// pruneEmpty removes empty objects from the tree so that unused nested
+// settings are not written out.
+func pruneEmpty(tree map[string]any) {
+	for key, value := range tree {
+		switch typed := value.(type) {
+		case nil:
+			delete(tree, key)
+		case map[string]any:
+			pruneEmpty(typed)
+			if len(typed) == 0 {
+				delete(tree, key)
+			}
+		case []any:
+			for _, item := range typed {
+				if itemMap, ok := item.(map[string]any); ok {
+					pruneEmpty(itemMap)
+				}
+			}
+		}
+	}
+}
+
+func exportCollection(collection *core.Collection) CollectionConfig {
+
+	// Collections designed in the admin UI stay editable there.
+	configuration := CollectionConfig{
+		ID:       collection.Id,
+		Name:     collection.Name,
+		Type:     collection.Type,
+		Editable: true,
+		Rules: RulesConfig{
+			ListRule: collection.ListRule,
+			ViewRule: collection.ViewRule,
+		},
+	}
+
+	if collection.Type == "view" {
+		configuration.ViewQuery = collection.ViewQuery
+		return configuration
+	}
+
+	configuration.Rules.CreateRule = collection.CreateRule
+	configuration.Rules.UpdateRule = collection.UpdateRule
+	configuration.Rules.DeleteRule = collection.DeleteRule
+
+	// The created and updated fields added by PocketBase are exported as
+	// add_default_fields rather than as fields.
+	configuration.AddDefaultFields = hasDefaultFields(collection)
+
+	for _, field := range collection.Fields {
+		if field.GetSystem() {
+			continue
+		}
+		if configuration.AddDefaultFields && isDefaultField(field) {
+			continue
+		}
+
+		fieldConfig, ok := exportField(field)
+		if !ok {
+			log.Printf("Skipping field %s on collection %s: unsupported field type %s", field.GetName(), collection.Name, field.Type())
+			continue
+		}
+		configuration.Fields = append(configuration.Fields, fieldConfig)
+	}
+
+	for _, index := range collection.Indexes {
+		indexConfig, ok := exportIndex(index)
+		if !ok {
+			log.Printf("Skipping index on collection %s that cannot be represented in config: %s", collection.Name, index)
+			continue
+		}
+		configuration.Indexes = append(configuration.Indexes, indexConfig)
+	}
+
+	if collection.Type == "auth" {
+		configuration.Rules.AuthRule = collection.AuthRule
+		configuration.Rules.ManageRule = collection.ManageRule
+		configuration.AuthConfig = exportAuthConfig(collection)
+	}
+
+	return configuration
+}
+
+// isDefaultField reports whether the field matches a created or updated field
+// added by add_default_fields.
+func isDefaultField(field core.Field) bool {
+	autodate, ok := field.(*core.AutodateField)
+	if !ok || autodate.Hidden || autodate.Presentable {
+		return false
+	}
+
+	switch autodate.Name {
+	case "created":
+		return autodate.OnCreate && !autodate.OnUpdate
+	case "updated":
+		return autodate.OnCreate && autodate.OnUpdate
+	default:
+		return false
+	}
+}
+
+// hasDefaultFields reports whether the collection has both of the fields
+// added by add_default_fields.
+func hasDefaultFields(collection *core.Collection) bool {
+	found := 0
+	for _, field := range collection.Fields {
+		if !field.GetSystem() && isDefaultField(field) {
+			found++
+		}
+	}
+	return found == 2
+}
+
+func exportIndex(index string) (IndexConfig, bool) {
+
+	parsed := dbutils.ParseIndex(index)
+	if !parsed.IsValid() {
+		return IndexConfig{}, false
+	}
+
+	indexConfig := IndexConfig{
+		Id:     parsed.IndexName,
+		Unique: parsed.Unique,
+		Where:  parsed.Where,
+	}
+
+	// Plain columns are listed as fields, anything else needs the full column form.
+	simple := true
+	for _, column := range parsed.Columns {
+		if column.Collate != "" || column.Sort != "" || !identifierPattern.MatchString(column.Name) {
+			simple = false
+			break
+		}
+	}
+
+	for _, column := range parsed.Columns {
+		if simple {
+			indexConfig.Fields = append(indexConfig.Fields, column.Name)
+			continue
+		}
+
+		columnConfig := IndexColumnConfig{
+			Collate: column.Collate,
+			Sort:    column.Sort,
+		}
+		if identifierPattern.MatchString(column.Name) {
+			columnConfig.Field = column.Name
+		} else {
+			columnConfig.Expression = column.Name
+		}
+		indexConfig.Columns = append(indexConfig.Columns, columnConfig)
+	}
+
+	return indexConfig, true
+}
+
+func exportField(field core.Field) (FieldConfig, bool) {
+
+	fieldConfig := FieldConfig{
+		Type:   field.Type(),
+		Id:     field.GetId(),
+		Name:   field.GetName(),
+		Hidden: field.GetHidden(),
+	}
+
+	switch typed := field.(type) {
+	case *core.TextField:
+		fieldConfig.Required = typed.Required
+		fieldConfig.Presentable = typed.Presentable
+		fieldConfig.Min = typed.Min
+		fieldConfig.Max = typed.Max
+		fieldConfig.Pattern = typed.Pattern
+		fieldConfig.AutogeneratePattern = typed.AutogeneratePattern
+	case *core.JSONField:
+		fieldConfig.Required = typed.Required
+		fieldConfig.Presentable = typed.Presentable
+		fieldConfig.MaxSize = typed.MaxSize
+	case *core.AutodateField:
+		fieldConfig.Presentable = typed.Presentable
+		fieldConfig.OnCreate = typed.OnCreate
+		fieldConfig.OnUpdate = typed.OnUpdate
+	case *core.FileField:
+		fieldConfig.Required = typed.Required
+		fieldConfig.Presentable = typed.Presentable
+		fieldConfig.MaxSize = typed.MaxSize
+		fieldConfig.MaxSelect = typed.MaxSelect
+		fieldConfig.Protected = typed.Protected
+		fieldConfig.MimeTypes = typed.MimeTypes
+		fieldConfig.Thumbs = typed.Thumbs
+	case *core.EmailField:
+		fieldConfig.Required = typed.Required
+		fieldConfig.Presentable = typed.Presentable
+		fieldConfig.ExceptDomains = typed.ExceptDomains
+		fieldConfig.OnlyDomains = typed.OnlyDomains
+	case *core.URLField:
+		fieldConfig.Required = typed.Required
+		fieldConfig.Presentable = typed.Presentable
+		fieldConfig.ExceptDomains = typed.ExceptDomains
+		fieldConfig.OnlyDomains = typed.OnlyDomains
+	case *core.DateField:
+		fieldConfig.Required = typed.Required
+		fieldConfig.Presentable = typed.Presentable
+		if !typed.Min.IsZero() {
+			fieldConfig.MinDate = typed.Min.String()
+		}
+		if !typed.Max.IsZero() {
+			fieldConfig.MaxDate = typed.Max.String()
+		}
+	case *core.EditorField:
+		fieldConfig.Required = typed.Required
+		fieldConfig.Presentable = typed.Presentable
+		fieldConfig.MaxSize = typed.MaxSize
+		fieldConfig.ConvertURLs = typed.ConvertURLs
+	case *core.SelectField:
+		fieldConfig.Required = typed.Required
+		fieldConfig.Presentable = typed.Presentable
+		fieldConfig.Values = typed.Values
+		fieldConfig.MaxSelect = typed.MaxSelect
+	case *core.PasswordField:
+		fieldConfig.Required = typed.Required
+		fieldConfig.Presentable = typed.Presentable
+		fieldConfig.Cost = typed.Cost
+		fieldConfig.Pattern = typed.Pattern
+		fieldConfig.Min = typed.Min
+		fieldConfig.Max = typed.Max
+	case *core.RelationField:
+		fieldConfig.Required = typed.Required
+		fieldConfig.Presentable = typed.Presentable
+		fieldConfig.CollectionId = typed.CollectionId
+		fieldConfig.CascadeDelete = typed.CascadeDelete
+		fieldConfig.MinSelect = typed.MinSelect
+		fieldConfig.MaxSelect = typed.MaxSelect
+	case *core.NumberField:
+		fieldConfig.Required = typed.Required
+		fieldConfig.Presentable = typed.Presentable
+		fieldConfig.OnlyInt = typed.OnlyInt
+		if typed.Min != nil {
+			fieldConfig.MinFloat = *typed.Min
+		}
+		if typed.Max != nil {
+			fieldConfig.MaxFloat = *typed.Max
+		}
+	case *core.BoolField:
+		fieldConfig.Required = typed.Required
+		fieldConfig.Presentable = typed.Presentable
+	default:
+		return FieldConfig{}, false
+	}
+
+	return fieldConfig, true
+}
+
+func exportEmailTemplate(template core.EmailTemplate) EmailTemplateConfig {
+	return EmailTemplateConfig{
+		Subject: template.Subject,
+		Body:    template.Body,
+	}
+}
+
+func exportAuthConfig(collection *core.Collection) *AuthConfig {
+
+	authConfig := &AuthConfig{
+		AuthAlert: AuthAlertConfig{
+			Enabled:       collection.AuthAlert.Enabled,
+			EmailTemplate: exportEmailTemplate(collection.AuthAlert.EmailTemplate),
+		},
+		AuthToken:                  TokenConfig{Duration: int(collection.AuthToken.Duration)},
+		ConfirmEmailChangeTemplate: exportEmailTemplate(collection.ConfirmEmailChangeTemplate),
+		EmailChangeToken:           TokenConfig{Duration: int(collection.EmailChangeToken.Duration)},
+		FileToken:                  TokenConfig{Duration: int(collection.FileToken.Duration)},
+		MFA: MFAConfig{
+			Enabled:  collection.MFA.Enabled,
+			Duration: int(collection.MFA.Duration),
+			Rule:     collection.MFA.Rule,
+		},
+		OTP: OTPConfig{
+			Enabled:       collection.OTP.Enabled,
+			Duration:      int(collection.OTP.Duration),
+			Length:        collection.OTP.Length,
+			EmailTemplate: exportEmailTemplate(collection.OTP.EmailTemplate),
+		},
+		PasswordAuth: PasswordConfig{
+			Enabled:        collection.PasswordAuth.Enabled,
+			IdentityFields: collection.PasswordAuth.IdentityFields,
+		},
+		PasswordResetToken:    TokenConfig{Duration: int(collection.PasswordResetToken.Duration)},
+		ResetPasswordTemplate: exportEmailTemplate(collection.ResetPasswordTemplate),
+		VerificationTemplate:  exportEmailTemplate(collection.VerificationTemplate),
+		VerificationToken:     TokenConfig{Duration: int(collection.VerificationToken.Duration)},
+		OAuth2: OAuth2Config{
+			Enabled: collection.OAuth2.Enabled,
+			MappedFields: OAuth2MappedFieldConfig{
+				AvatarURL: collection.OAuth2.MappedFields.AvatarURL,
+				Id:        collection.OAuth2.MappedFields.Id,
+				Name:      collection.OAuth2.MappedFields.Name,
+				Username:  collection.OAuth2.MappedFields.Username,
+			},
+		},
+	}
+
+	// Client secrets are not exported. The provider reads its secret from an
+	// environment variable instead, which has to be set to use the export.
+	for _, provider := range collection.OAuth2.Providers {
+		providerConfig := OAuth2ProviderConfig{
+			PKCE:        provider.PKCE,
+			Name:        provider.Name,
+			ClientId:    provider.ClientId,
+			AuthURL:     provider.AuthURL,
+			TokenURL:    provider.TokenURL,
+			UserInfoURL: provider.UserInfoURL,
+			DisplayName: provider.DisplayName,
+			Extra:       provider.Extra,
+		}
+		if provider.ClientSecret != "" {
+			providerConfig.ClientSecretEnv = clientSecretEnvName(collection.Name, provider.Name)
+		}
+		authConfig.OAuth2.Providers = append(authConfig.OAuth2.Providers, providerConfig)
+	}
+
+	return authConfig
+}
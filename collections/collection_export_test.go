@@ -0,0 +1,76 @@
+package collections
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/viper"
+)
+
+func TestExportCollectionsRoundTrip(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	collection := core.NewBaseCollection("export_round_trip")
+	collection.ListRule = types.Pointer("")
+	collection.ViewRule = types.Pointer("@request.auth.id != ''")
+	collection.Fields.Add(
+		&core.TextField{Name: "title", Required: true, Max: 100},
+		&core.NumberField{Name: "count", OnlyInt: true},
+		&core.SelectField{Name: "status", Values: []string{"draft", "published"}, MaxSelect: 1},
+		&core.AutodateField{Name: "created", OnCreate: true},
+		&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+	)
+	collection.AddIndex("idx_export_round_trip_title", true, "title", "")
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	pluginConfig, err := ExportCollections(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the new collection is compared, the test data has others.
+	var exported []CollectionConfig
+	for _, collectionConfig := range pluginConfig.Collections {
+		if collectionConfig.Name == collection.Name {
+			exported = append(exported, collectionConfig)
+		}
+	}
+	if len(exported) != 1 {
+		t.Fatalf("expected the collection to be exported, got %d collections", len(exported))
+	}
+	if !exported[0].Editable || !exported[0].AddDefaultFields {
+		t.Errorf("expected editable and add_default_fields to be exported, got %v and %v", exported[0].Editable, exported[0].AddDefaultFields)
+	}
+	pluginConfig.Collections = exported
+	pluginConfig.RetainUnconfiguredCollections = true
+
+	output, err := MarshalCollectionsConfig(pluginConfig, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := viper.New()
+	v.SetConfigType("json")
+	if err := v.ReadConfig(bytes.NewReader(output)); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := PlanCollections(app, v.Sub("collections"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Changes) > 0 {
+		var buffer bytes.Buffer
+		changes.Print(&buffer)
+		t.Errorf("expected the exported configuration to make no changes, got:\n%s", buffer.String())
+	}
+}
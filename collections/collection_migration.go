@@ -0,0 +1,213 @@
+package collections
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/viper"
+)
+
+// collectionSnapshot holds the JSON form of every collection, in the order
+// returned by FindAllCollections.
+type collectionSnapshot struct {
+	ids         []string
+	collections map[string]map[string]any
+}
+
+// GenerateMigration compares the collections configuration with the database
+// and returns a JS migration that makes the same changes, along with the
+// changes themselves. The configuration is applied inside a transaction that is
+// always rolled back. If the configuration makes no changes the migration is nil.
+//
+// Changes to stored records (seeds, select value renames and field type changes
+// that keep the data) cannot be reproduced by importing the collections, so
+// the migration is refused unless allowDataChanges is set, in which case they
+// are listed in a comment at the top of the migration.
+func GenerateMigration(app core.App, v *viper.Viper, allowDataChanges bool) ([]byte, *ChangeLog, error) {
+	changes := &ChangeLog{DryRun: true}
+
+	var before, after *collectionSnapshot
+	err := reconcileInTransaction(app, false, func(txApp core.App) error {
+		var err error
+		if before, err = snapshotCollections(txApp); err != nil {
+			return err
+		}
+
+		if err := applyCollections(txApp, v, changes); err != nil {
+			return err
+		}
+
+		after, err = snapshotCollections(txApp)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataChanges := changes.dataChanges()
+	if len(dataChanges) > 0 && !allowDataChanges {
+		lines := make([]string, 0, len(dataChanges))
+		for _, change := range dataChanges {
+			lines = append(lines, "  "+change.String())
+		}
+		return nil, changes, fmt.Errorf(
+			"the configuration updates stored records, which a migration of the collections does not reproduce:\n%s\n"+
+				"apply the configuration on every environment, or use --allow-data-changes to write the migration without these changes",
+			strings.Join(lines, "\n"),
+		)
+	}
+
+	var created, updated, deleted []string
+	for _, id := range after.ids {
+		previous, found := before.collections[id]
+		if !found {
+			created = append(created, id)
+		} else if !reflect.DeepEqual(previous, after.collections[id]) {
+			updated = append(updated, id)
+		}
+	}
+	for _, id := range before.ids {
+		if _, found := after.collections[id]; !found {
+			deleted = append(deleted, id)
+		}
+	}
+
+	if len(created)+len(updated)+len(deleted) == 0 {
+		return nil, changes, nil
+	}
+
+	var up, down strings.Builder
+	if err := writeMigrationDeletes(&up, before, deleted); err != nil {
+		return nil, nil, err
+	}
+	if err := writeMigrationImport(&up, after, append(created, updated...)); err != nil {
+		return nil, nil, err
+	}
+	if err := writeMigrationDeletes(&down, after, created); err != nil {
+		return nil, nil, err
+	}
+	if err := writeMigrationImport(&down, before, append(updated, deleted...)); err != nil {
+		return nil, nil, err
+	}
+
+	var header strings.Builder
+	header.WriteString("/// <reference path=\"../pb_data/types.d.ts\" />\n")
+	if len(dataChanges) > 0 {
+		header.WriteString("\n// This migration does not include these changes to stored records:\n")
+		for _, change := range dataChanges {
+			fmt.Fprintf(&header, "//   %s\n", change)
+		}
+		header.WriteString("\n")
+	}
+
+	migration := fmt.Sprintf("%smigrate((app) => {\n%s}, (app) => {\n%s})\n", header.String(), up.String(), down.String())
+
+	return []byte(migration), changes, nil
+}
+
+func snapshotCollections(app core.App) (*collectionSnapshot, error) {
+	collections, err := app.FindAllCollections()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find collections: %w", err)
+	}
+
+	snapshot := &collectionSnapshot{collections: map[string]map[string]any{}}
+	for _, collection := range collections {
+		raw, err := json.Marshal(collection)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read collection %s: %w", collection.Name, err)
+		}
+
+		var data map[string]any
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, fmt.Errorf("failed to read collection %s: %w", collection.Name, err)
+		}
+
+		// The timestamps change on every save and are not part of the schema.
+		delete(data, "created")
+		delete(data, "updated")
+
+		replaceClientSecrets(collection.Name, data)
+
+		snapshot.ids = append(snapshot.ids, collection.Id)
+		snapshot.collections[collection.Id] = data
+	}
+
+	return snapshot, nil
+}
+
+// secretPlaceholderPrefix marks a client secret replaced with an environment
+// variable in the snapshot. The placeholder is turned into a $os.getenv call
+// when the migration is written.
+const secretPlaceholderPrefix = "__pocketforge_env__:"
+
+var secretPlaceholderPattern = regexp.MustCompile(`"` + secretPlaceholderPrefix + `(\w+)"`)
+
+// replaceClientSecrets replaces the OAuth2 client secrets in the collection
+// data with placeholders, so that the secrets are not written to migrations.
+// The migration reads them from an environment variable instead.
+func replaceClientSecrets(collectionName string, data map[string]any) {
+	oauth2, _ := data["oauth2"].(map[string]any)
+	providers, _ := oauth2["providers"].([]any)
+
+	for _, item := range providers {
+		provider, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		if secret, _ := provider["clientSecret"].(string); secret != "" {
+			name, _ := provider["name"].(string)
+			provider["clientSecret"] = secretPlaceholderPrefix + clientSecretEnvName(collectionName, name)
+		}
+	}
+}
+
+// writeMigrationDeletes writes the statements deleting the collections, with
+// views first so they are removed before the collections they select from.
+func writeMigrationDeletes(builder *strings.Builder, snapshot *collectionSnapshot, ids []string) error {
+	var views, others []string
+	for _, id := range ids {
+		if snapshot.collections[id]["type"] == core.CollectionTypeView {
+			views = append(views, id)
+		} else {
+			others = append(others, id)
+		}
+	}
+
+	for _, id := range append(views, others...) {
+		quotedId, err := json.Marshal(id)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(builder, "  app.delete(app.findCollectionByNameOrId(%s));\n", quotedId)
+	}
+
+	return nil
+}
+
+// writeMigrationImport writes the statement creating or updating the collections
+// from their snapshot.
+func writeMigrationImport(builder *strings.Builder, snapshot *collectionSnapshot, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	collections := make([]map[string]any, 0, len(ids))
+	for _, id := range ids {
+		collections = append(collections, snapshot.collections[id])
+	}
+
+	raw, err := json.MarshalIndent(collections, "  ", "  ")
+	if err != nil {
+		return err
+	}
+
+	raw = secretPlaceholderPattern.ReplaceAll(raw, []byte(`$$os.getenv("$1")`))
+
+	fmt.Fprintf(builder, "  app.importCollections(%s, false);\n", raw)
+	return nil
+}
@@ -0,0 +1,58 @@
+package collections
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// collectionPattern matches collection names against a name, a glob pattern
+// (such as legacy_*) or a regular expression written between slashes (such as
+// /^tmp_[0-9]+$/).
+type collectionPattern struct {
+	pattern string
+	regex   *regexp.Regexp
+}
+
+func compileCollectionPatterns(patterns []string) ([]collectionPattern, error) {
+
+	compiled := make([]collectionPattern, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			regex, err := regexp.Compile(pattern[1 : len(pattern)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid collection pattern %s: %w", pattern, err)
+			}
+			compiled = append(compiled, collectionPattern{pattern: pattern, regex: regex})
+			continue
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid collection pattern %s: %w", pattern, err)
+		}
+		compiled = append(compiled, collectionPattern{pattern: pattern})
+	}
+
+	return compiled, nil
+}
+
+func (pattern collectionPattern) match(name string) bool {
+	if pattern.regex != nil {
+		return pattern.regex.MatchString(name)
+	}
+
+	matched, _ := path.Match(pattern.pattern, name)
+	return matched
+}
+
+// matchCollectionPatterns reports whether the name matches any of the patterns.
+func matchCollectionPatterns(patterns []collectionPattern, name string) bool {
+	for _, pattern := range patterns {
+		if pattern.match(name) {
+			return true
+		}
+	}
+	return false
+}
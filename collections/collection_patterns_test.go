@@ -0,0 +1,57 @@
+package collections
+
+import "testing"
+
+func TestCompileCollectionPatterns(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		wantErr  bool
+	}{
+		{patterns: nil},
+		{patterns: []string{"users", "legacy_*", "/^tmp_[0-9]+$/"}},
+		{patterns: []string{"/"}},
+		{patterns: []string{"/[/"}, wantErr: true},
+		{patterns: []string{"legacy_["}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		_, err := compileCollectionPatterns(test.patterns)
+		if (err != nil) != test.wantErr {
+			t.Errorf("compileCollectionPatterns(%q) error = %v, want error %v", test.patterns, err, test.wantErr)
+		}
+	}
+}
+
+func TestMatchCollectionPatterns(t *testing.T) {
+	patterns, err := compileCollectionPatterns([]string{"users", "legacy_*", "/^tmp_[0-9]+$/", "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "users", want: true},
+		{name: "Users", want: false},
+		{name: "users_extra", want: false},
+		{name: "legacy_", want: true},
+		{name: "legacy_posts", want: true},
+		{name: "old_legacy_posts", want: false},
+		{name: "tmp_123", want: true},
+		{name: "tmp_abc", want: false},
+		{name: "tmp_123_x", want: false},
+		{name: "/", want: true},
+		{name: "posts", want: false},
+	}
+
+	for _, test := range tests {
+		if got := matchCollectionPatterns(patterns, test.name); got != test.want {
+			t.Errorf("matchCollectionPatterns(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	if matchCollectionPatterns(nil, "users") {
+		t.Error("expected no patterns to match nothing")
+	}
+}
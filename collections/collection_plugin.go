@@ -1,143 +1,302 @@
 package collections
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 
-	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
 	"github.com/spf13/viper"
 )
 
 type CollectionPluginConfig struct {
-	Enabled                       bool               `mapstructure:"enabled" json:"enabled"`
-	RetainUnconfiguredCollections bool               `mapstructure:"retain_unconfigured_collections" json:"retain_unconfigured_collections"`
-	FilterPrefix                  string             `mapstructure:"filter_prefix" json:"filter_prefix"`
-	Collections                   []CollectionConfig `mapstructure:"collections" json:"collections"`
+	Enabled                       bool                     `mapstructure:"enabled" json:"enabled,omitempty"`
+	RetainUnconfiguredCollections bool                     `mapstructure:"retain_unconfigured_collections" json:"retain_unconfigured_collections,omitempty"`
+	FilterPrefix                  string                   `mapstructure:"filter_prefix" json:"filter_prefix,omitempty"`
+	RetainCollections             []string                 `mapstructure:"retain_collections" json:"retain_collections,omitempty"`
+	ManagedCollections            []string                 `mapstructure:"managed_collections" json:"managed_collections,omitempty"`
+	Prune                         PruneConfig              `mapstructure:"prune" json:"prune,omitempty"`
+	FieldGroups                   map[string][]FieldConfig `mapstructure:"field_groups" json:"field_groups,omitempty"`
+	RulePresets                   map[string]RulesConfig   `mapstructure:"rule_presets" json:"rule_presets,omitempty"`
+	Collections                   []CollectionConfig       `mapstructure:"collections" json:"collections,omitempty"`
 }
 
-func SetupCollections(app *pocketbase.PocketBase, v *viper.Viper) {
+// errPlanRollback is returned from the plan transaction to discard every change.
+var errPlanRollback = errors.New("collections plan rollback")
+
+// SetupCollections reconciles the database with the collections configuration
+// inside a single transaction and logs every change that was made. If any step
+// fails the transaction is rolled back and the database is left unchanged.
+func SetupCollections(app core.App, v *viper.Viper) error {
+	changes := &ChangeLog{}
+
+	err := reconcileInTransaction(app, true, func(txApp core.App) error {
+		return applyCollections(txApp, v, changes)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes.Changes {
+		log.Printf("Collections: %s", change)
+	}
+
+	return nil
+}
+
+// PlanCollections runs the reconciliation inside a transaction that is always
+// rolled back, returning the changes that SetupCollections would make.
+func PlanCollections(app core.App, v *viper.Viper) (*ChangeLog, error) {
+	changes := &ChangeLog{DryRun: true}
+
+	err := reconcileInTransaction(app, false, func(txApp core.App) error {
+		return applyCollections(txApp, v, changes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// reconcileInTransaction runs reconcile within app.RunInTransaction. Any error
+// (or unexpected panic) rolls the transaction back. When commit is false the
+// transaction is always rolled back.
+func reconcileInTransaction(app core.App, commit bool, reconcile func(txApp core.App) error) error {
+	err := app.RunInTransaction(func(txApp core.App) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("unexpected panic: %v", r)
+			}
+		}()
+
+		if err := reconcile(txApp); err != nil {
+			return err
+		}
+
+		if !commit {
+			return errPlanRollback
+		}
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errPlanRollback) {
+		return fmt.Errorf("collections configuration was not applied: %w", err)
+	}
+
+	return nil
+}
+
+func applyCollections(app core.App, v *viper.Viper, changes *ChangeLog) error {
 
 	if v == nil {
-		return
+		return nil
 	}
 
 	v.SetDefault("enabled", true)
 	v.SetDefault("retain_unconfigured_collections", false)
 	v.SetDefault("filter_prefix", "_")
+	v.SetDefault("retain_collections", []string{"users"})
+	setPruneDefaults(v)
 
 	if !v.GetBool("enabled") {
-		return
+		return nil
 	}
 
 	pluginConfig := CollectionPluginConfig{}
 	err := v.Unmarshal(&pluginConfig)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to read collections configuration: %w", err)
 	}
 
-	// First we need to remove all teh indexes to allow removal of indexed fields.
-	for _, collectionConfig := range pluginConfig.Collections {
-		collectionConfig.RemoveIndexes(app)
-		if collectionConfig.Type == "view" {
-			collectionConfig.RemoveCollection(app)
+	if err := pluginConfig.Prune.validate(); err != nil {
+		return err
+	}
+
+	if err := pluginConfig.applyTemplates(v); err != nil {
+		return err
+	}
+
+	for i := range pluginConfig.Collections {
+		collectionConfig := &pluginConfig.Collections[i]
+		if collectionConfig.PruneMode != "" && collectionConfig.PruneMode != PruneModeDelete && collectionConfig.PruneMode != PruneModeRetire {
+			return fmt.Errorf("collection %s has invalid prune mode %s", collectionConfig.Name, collectionConfig.PruneMode)
 		}
+		collectionConfig.changes = changes
+		collectionConfig.prune = &pluginConfig.Prune
+	}
+
+	views, err := orderViews(pluginConfig.Collections)
+	if err != nil {
+		return err
+	}
+
+	report := &ReconcileReport{}
+
+	// Collections that could not be created are skipped in the later steps so
+	// the same failure is not reported repeatedly.
+	failed := map[string]bool{}
+
+	// First remove the indexes that have changed or are no longer configured, to allow removal of indexed fields.
+	for i := range pluginConfig.Collections {
+		collectionConfig := &pluginConfig.Collections[i]
+		report.add(collectionConfig.Name, "", "remove indexes", collectionConfig.RemoveIndexes(app))
 	}
 
+	// Views selecting from fields that are about to change have to be removed before the fields are updated.
+	report.add("", "", "remove views", removeChangedViews(app, pluginConfig.Collections, views))
+
 	// First create collections and then create fields to ensure the collections exist prior to creating any reference fields.
-	for _, collectionConfig := range pluginConfig.Collections {
+	for i := range pluginConfig.Collections {
+		collectionConfig := &pluginConfig.Collections[i]
 		if collectionConfig.Type == "view" {
 			continue
 		}
-		collectionConfig.CreateOrUpdateCollection(app)
+		if err := collectionConfig.CreateOrUpdateCollection(app); err != nil {
+			report.add(collectionConfig.Name, "", "create collection", err)
+			failed[collectionConfig.ID] = true
+		}
 	}
 
-	// Create View Collections
-	for _, collectionConfig := range pluginConfig.Collections {
-		if collectionConfig.Type == "view" {
-			collectionConfig.CreateOrUpdateCollection(app)
+	// Collections that select values are loaded from (and the collections they
+	// depend on) are configured and seeded first, in dependency order, so that
+	// the values exist when the select fields are updated. Their indexes are
+	// created before seeding so that unique indexes apply to the seed records.
+	// Their rules may refer to fields that are not configured yet, so they are
+	// applied again (and any error reported) with the rules of the others.
+	ordered := seedOrder(pluginConfig.Collections)
+	sources := valuesSources(ordered)
+	seeded := map[string]bool{}
+	for _, collectionConfig := range ordered {
+		if !sources[collectionConfig] || failed[collectionConfig.ID] {
+			continue
 		}
+		report.add(collectionConfig.Name, "", "update fields", collectionConfig.UpdateFields(app))
+		report.add(collectionConfig.Name, "", "update indexes", collectionConfig.updateIndexes(app))
+		_ = collectionConfig.updateRules(app)
+		report.add(collectionConfig.Name, "", "seed records", collectionConfig.seedRecords(app))
+		seeded[collectionConfig.ID] = true
 	}
 
-	for _, collectionConfig := range pluginConfig.Collections {
-		collectionConfig.UpdateFields(app)
+	for i := range pluginConfig.Collections {
+		collectionConfig := &pluginConfig.Collections[i]
+		if collectionConfig.Type == "view" || failed[collectionConfig.ID] || seeded[collectionConfig.ID] {
+			continue
+		}
+		report.add(collectionConfig.Name, "", "update fields", collectionConfig.UpdateFields(app))
+	}
+
+	// Create View Collections once the fields they select from exist, after the views they select from.
+	for _, collectionConfig := range views {
+		if err := collectionConfig.CreateOrUpdateCollection(app); err != nil {
+			report.add(collectionConfig.Name, "", "create view", err)
+			failed[collectionConfig.ID] = true
+		}
+	}
+
+	// Rules and indexes may refer to any field, so they are applied last.
+	for i := range pluginConfig.Collections {
+		collectionConfig := &pluginConfig.Collections[i]
+		if failed[collectionConfig.ID] {
+			continue
+		}
+		report.add(collectionConfig.Name, "", "update rules", collectionConfig.updateRules(app))
+		if collectionConfig.Type != "view" {
+			report.add(collectionConfig.Name, "", "update indexes", collectionConfig.updateIndexes(app))
+		}
+		report.add(collectionConfig.Name, "", "lock collection", collectionConfig.lockCollection(app))
 	}
 
 	//Update Auth Collection Details
-	for id, collectionConfig := range pluginConfig.Collections {
-		if collectionConfig.Type == "auth" {
+	for id := range pluginConfig.Collections {
+		collectionConfig := &pluginConfig.Collections[id]
+		if collectionConfig.Type == "auth" && !failed[collectionConfig.ID] {
 			vAuth := v.Sub(fmt.Sprintf("collections.%v.auth", id))
-			collectionConfig.ConfigAuth(app, vAuth)
+			report.add(collectionConfig.Name, "", "configure auth", collectionConfig.ConfigAuth(app, vAuth))
 		}
 	}
 
-	pluginConfig.removeUnusedCollections(app)
+	report.add("", "", "remove unused collections", pluginConfig.removeUnusedCollections(app, changes))
 
+	// Seed records once every collection is in its final state, seeding the
+	// collections that relations refer to first.
+	for _, collectionConfig := range ordered {
+		if failed[collectionConfig.ID] || seeded[collectionConfig.ID] {
+			continue
+		}
+		report.add(collectionConfig.Name, "", "seed records", collectionConfig.seedRecords(app))
+	}
+
+	return report.err()
 }
 
-func (config *CollectionPluginConfig) removeUnusedCollections(app *pocketbase.PocketBase) {
+// removeUnusedCollections removes (or retires) the collections that are not in
+// the configuration. System collections, collections with the filter prefix and
+// collections matching retain_collections are kept, unless they match
+// managed_collections. When retain_unconfigured_collections is set, only the
+// collections matching managed_collections are removed.
+func (config *CollectionPluginConfig) removeUnusedCollections(app core.App, changes *ChangeLog) error {
 
-	if config.RetainUnconfiguredCollections {
-		return
+	retainPatterns, err := compileCollectionPatterns(config.RetainCollections)
+	if err != nil {
+		return err
 	}
 
-	collections_to_retain := []string{"users"}
+	managedPatterns, err := compileCollectionPatterns(config.ManagedCollections)
+	if err != nil {
+		return err
+	}
 
-	var collections_in_config []string
-	var collectionIds_in_config []string
+	configured := map[string]bool{}
 	for _, collectionConfig := range config.Collections {
-		collections_in_config = append(collections_in_config, collectionConfig.Name)
-		collectionIds_in_config = append(collectionIds_in_config, collectionConfig.ID)
+		configured[collectionConfig.Name] = true
+		configured[collectionConfig.ID] = true
 	}
 
 	collections, err := app.FindAllCollections()
 	if err != nil {
-		log.Panicf("Failed to find collections: %v", err)
+		return fmt.Errorf("failed to find collections: %w", err)
 	}
 
+	report := &ReconcileReport{}
+
 	for _, collection := range collections {
-		found := false
 
-		// Do not remove collections in the list of collections in the config.
-		for _, collectionName := range collections_in_config {
-			if collectionName == collection.Name {
-				found = true
-				break
-			}
+		// Do not remove system collections or collections in the config.
+		if collection.System || configured[collection.Name] || configured[collection.Id] {
+			continue
 		}
 
-		// Do not remove collections in the list of items to retain.
-		for _, collectionName := range collections_to_retain {
-			if collectionName == collection.Name {
-				found = true
-				break
+		// Retired collections are kept until their grace period is over.
+		if retiredAt, retired := config.Prune.retiredAt(collection.Name); retired {
+			if config.Prune.expired(retiredAt) {
+				changes.record(ChangeDelete, "collection", collection.Name, "", "retired, grace period over")
+				report.add(collection.Name, "", "remove collection", app.Delete(collection))
 			}
+			continue
 		}
 
-		// Do not remove collections in the list of items to retain.
-		for _, collectionId := range collectionIds_in_config {
-			if collectionId == collection.Id {
-				found = true
-				break
+		if !matchCollectionPatterns(managedPatterns, collection.Name) {
+			if config.RetainUnconfiguredCollections {
+				continue
 			}
-		}
-
-		// Do not remove collections with the filter prefix
-		if strings.HasPrefix(collection.Name, config.FilterPrefix) {
-			found = true
-		}
 
-		// Do not remove system collections
-		if collection.System {
-			found = true
+			// Do not remove collections with the filter prefix or in the list of collections to retain.
+			if strings.HasPrefix(collection.Name, config.FilterPrefix) || matchCollectionPatterns(retainPatterns, collection.Name) {
+				continue
+			}
 		}
 
-		if !found {
-			collection, err := app.FindCollectionByNameOrId(collection.Name)
-			if err != nil {
-				log.Panicf("Failed to find collection %s: %v", collection.Name, err)
-			}
-			app.Delete(collection)
+		if config.Prune.Mode == PruneModeRetire {
+			retiredName := config.Prune.retiredName(collection.Name)
+			changes.record(ChangeUpdate, "collection", collection.Name, "", "not in config, retired as "+retiredName)
+			report.add(collection.Name, "", "retire collection", retireCollection(app, collection, &config.Prune))
+		} else {
+			changes.record(ChangeDelete, "collection", collection.Name, "", "not in config")
+			report.add(collection.Name, "", "remove collection", app.Delete(collection))
 		}
 	}
+
+	return report.err()
 }
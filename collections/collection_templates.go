@@ -0,0 +1,124 @@
+package collections
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// applyTemplates expands the field groups and rule presets used by each
+// collection. Fields from the groups listed in mixins are added after the
+// collection's own fields, unless the collection already has a field with the
+// same name. Rules that the collection does not set are taken from the rule
+// preset named by extends.
+func (config *CollectionPluginConfig) applyTemplates(v *viper.Viper) error {
+
+	ruleKeys := configuredRuleKeys(v)
+
+	for i := range config.Collections {
+		collectionConfig := &config.Collections[i]
+
+		if collectionConfig.Extends != "" {
+			// Viper lower cases map keys, so the names are matched case insensitively.
+			preset, found := config.RulePresets[strings.ToLower(collectionConfig.Extends)]
+			if !found {
+				return fmt.Errorf("collection %s extends unknown rule preset %s", collectionConfig.Name, collectionConfig.Extends)
+			}
+			var configured map[string]bool
+			if i < len(ruleKeys) {
+				configured = ruleKeys[i]
+			}
+			collectionConfig.Rules.applyPreset(preset, collectionConfig.Type, configured)
+		}
+
+		for _, mixin := range collectionConfig.Mixins {
+			group, found := config.FieldGroups[strings.ToLower(mixin)]
+			if !found {
+				return fmt.Errorf("collection %s includes unknown field group %s", collectionConfig.Name, mixin)
+			}
+			collectionConfig.addFields(group)
+		}
+	}
+
+	return nil
+}
+
+// applyPreset sets each rule that is not configured to the rule from the preset.
+// A rule configured as null (superusers only) is kept. View collections only
+// take the list and view rules.
+func (rules *RulesConfig) applyPreset(preset RulesConfig, collectionType string, configured map[string]bool) {
+
+	setDefaultRule(&rules.ListRule, preset.ListRule, configured["list_rule"])
+	setDefaultRule(&rules.ViewRule, preset.ViewRule, configured["view_rule"])
+
+	if collectionType == "view" {
+		return
+	}
+
+	setDefaultRule(&rules.CreateRule, preset.CreateRule, configured["create_rule"])
+	setDefaultRule(&rules.UpdateRule, preset.UpdateRule, configured["update_rule"])
+	setDefaultRule(&rules.DeleteRule, preset.DeleteRule, configured["delete_rule"])
+
+	if collectionType == "auth" {
+		setDefaultRule(&rules.AuthRule, preset.AuthRule, configured["auth_rule"])
+		setDefaultRule(&rules.ManageRule, preset.ManageRule, configured["manage_rule"])
+	}
+}
+
+func setDefaultRule(rule **string, preset *string, configured bool) {
+	if *rule == nil && !configured {
+		*rule = preset
+	}
+}
+
+// configuredRuleKeys returns the rule keys set on each collection. A rule set
+// to null is nil once unmarshalled, and is not reported by viper's IsSet, so
+// the keys are read from the rules map itself.
+func configuredRuleKeys(v *viper.Viper) []map[string]bool {
+	var items []map[string]any
+	switch collections := v.Get("collections").(type) {
+	case []any:
+		for _, item := range collections {
+			collection, _ := item.(map[string]any)
+			items = append(items, collection)
+		}
+	case []map[string]any:
+		items = collections
+	}
+
+	keys := make([]map[string]bool, len(items))
+	for i, collection := range items {
+		keys[i] = map[string]bool{}
+		rules, _ := collection["rules"].(map[string]any)
+		for key := range rules {
+			keys[i][strings.ToLower(key)] = true
+		}
+	}
+
+	return keys
+}
+
+// addFields adds the fields from a field group. Field ids in a group are
+// prefixed with the collection name, as field ids must be unique across all
+// collections.
+func (configuration *CollectionConfig) addFields(group []FieldConfig) {
+
+	existing := map[string]bool{}
+	for _, fieldConfig := range configuration.Fields {
+		existing[fieldConfig.Name] = true
+	}
+
+	for _, fieldConfig := range group {
+		if existing[fieldConfig.Name] {
+			continue
+		}
+
+		if fieldConfig.Id != "" {
+			fieldConfig.Id = configuration.Name + "_" + fieldConfig.Id
+		}
+
+		configuration.Fields = append(configuration.Fields, fieldConfig)
+		existing[fieldConfig.Name] = true
+	}
+}
@@ -0,0 +1,76 @@
+package collections
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestApplyTemplatesRulePresets(t *testing.T) {
+	config := `
+rule_presets:
+  owner_only:
+    list_rule: "owner = @request.auth.id"
+    view_rule: "owner = @request.auth.id"
+    create_rule: "owner = @request.auth.id"
+    update_rule: "owner = @request.auth.id"
+    delete_rule: "owner = @request.auth.id"
+collections:
+  - id: posts
+    name: posts
+    type: base
+    extends: Owner_Only
+    rules:
+      create_rule: ""
+      delete_rule: null
+  - id: posts_view
+    name: posts_view
+    type: view
+    extends: owner_only
+    rules:
+      view_rule: null
+`
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+
+	pluginConfig := CollectionPluginConfig{}
+	if err := v.Unmarshal(&pluginConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := pluginConfig.applyTemplates(v); err != nil {
+		t.Fatal(err)
+	}
+
+	preset := "owner = @request.auth.id"
+	empty := ""
+
+	tests := []struct {
+		name string
+		rule *string
+		want *string
+	}{
+		{name: "posts list rule from the preset", rule: pluginConfig.Collections[0].Rules.ListRule, want: &preset},
+		{name: "posts update rule from the preset", rule: pluginConfig.Collections[0].Rules.UpdateRule, want: &preset},
+		{name: "posts create rule overridden", rule: pluginConfig.Collections[0].Rules.CreateRule, want: &empty},
+		{name: "posts delete rule set to null", rule: pluginConfig.Collections[0].Rules.DeleteRule, want: nil},
+		{name: "view list rule from the preset", rule: pluginConfig.Collections[1].Rules.ListRule, want: &preset},
+		{name: "view view rule set to null", rule: pluginConfig.Collections[1].Rules.ViewRule, want: nil},
+		{name: "view create rule not applied", rule: pluginConfig.Collections[1].Rules.CreateRule, want: nil},
+	}
+
+	for _, test := range tests {
+		switch {
+		case test.want == nil && test.rule != nil:
+			t.Errorf("%s: got %q, want null", test.name, *test.rule)
+		case test.want != nil && test.rule == nil:
+			t.Errorf("%s: got null, want %q", test.name, *test.want)
+		case test.want != nil && *test.rule != *test.want:
+			t.Errorf("%s: got %q, want %q", test.name, *test.rule, *test.want)
+		}
+	}
+}
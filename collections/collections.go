@@ -1,6 +1,8 @@
 package collections
 
 import (
+	"fmt"
+
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/spf13/viper"
@@ -8,6 +10,8 @@ import (
 
 func SetupConfiguredCollections(app *pocketbase.PocketBase, vAll *viper.Viper) {
 
+	app.RootCmd.AddCommand(newCollectionsCommand(app, vAll))
+
 	v := vAll.Sub("collections")
 
 	if v == nil {
@@ -20,9 +24,24 @@ func SetupConfiguredCollections(app *pocketbase.PocketBase, vAll *viper.Viper) {
 		return
 	}
 
+	bindEmailTemplateText(app)
+
 	app.OnServe().BindFunc(func(e *core.ServeEvent) error {
 
-		SetupCollections(app, v)
+		if err := SetupCollections(app, v); err != nil {
+			return err
+		}
+
+		watcher, err := watchEmailTemplates(app)
+		if err != nil {
+			return fmt.Errorf("failed to watch email templates: %w", err)
+		}
+		if watcher != nil {
+			app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+				watcher.Close()
+				return e.Next()
+			})
+		}
 
 		return e.Next()
 	})
@@ -0,0 +1,160 @@
+package collections
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// newCollectionsCommand creates the "collections" command group, used to work
+// with the collections configuration without starting the server.
+func newCollectionsCommand(app core.App, vAll *viper.Viper) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "collections",
+		Short: "Inspect and manage the configured collections",
+	}
+
+	command.AddCommand(newPlanCommand(app, vAll))
+	command.AddCommand(newExportCommand(app))
+	command.AddCommand(newMigrationCommand(app, vAll))
+	command.AddCommand(newPruneCommand(app, vAll))
+
+	return command
+}
+
+func newPlanCommand(app core.App, vAll *viper.Viper) *cobra.Command {
+	return &cobra.Command{
+		Use:          "plan",
+		Short:        "Print the changes the collections configuration would make, without saving them",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := vAll.Sub("collections")
+			if v == nil {
+				return errors.New("no collections configuration found")
+			}
+
+			changes, err := PlanCollections(app, v)
+			if err != nil {
+				return err
+			}
+
+			changes.Print(cmd.OutOrStdout())
+			return nil
+		},
+	}
+}
+
+func newExportCommand(app core.App) *cobra.Command {
+	var format string
+
+	command := &cobra.Command{
+		Use:          "export",
+		Short:        "Print the existing collections as a collections configuration",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pluginConfig, err := ExportCollections(app)
+			if err != nil {
+				return err
+			}
+
+			output, err := MarshalCollectionsConfig(pluginConfig, format)
+			if err != nil {
+				return err
+			}
+
+			_, err = cmd.OutOrStdout().Write(output)
+			return err
+		},
+	}
+
+	command.Flags().StringVar(&format, "format", "yaml", "output format (yaml, toml or json)")
+
+	return command
+}
+
+// migrationNamePattern matches the characters that are replaced in migration file names.
+var migrationNamePattern = regexp.MustCompile(`\W+`)
+
+func newMigrationCommand(app core.App, vAll *viper.Viper) *cobra.Command {
+	var allowDataChanges bool
+
+	command := &cobra.Command{
+		Use:          "migration [name]",
+		Short:        "Write a JS migration making the changes in the collections configuration",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := vAll.Sub("collections")
+			if v == nil {
+				return errors.New("no collections configuration found")
+			}
+
+			name := "collections_config"
+			if len(args) > 0 {
+				name = migrationNamePattern.ReplaceAllString(args[0], "_")
+			}
+
+			migration, changes, err := GenerateMigration(app, v, allowDataChanges)
+			if err != nil {
+				return err
+			}
+
+			changes.Print(cmd.OutOrStdout())
+			if migration == nil {
+				return nil
+			}
+
+			dir := vAll.GetString("settings.migrations_dir")
+			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+				return fmt.Errorf("failed to create migrations directory: %w", err)
+			}
+
+			path := filepath.Join(dir, fmt.Sprintf("%d_%s.js", time.Now().Unix(), name))
+			if err := os.WriteFile(path, migration, 0644); err != nil {
+				return fmt.Errorf("failed to write migration: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "\nMigration written to %s\n", path)
+			return nil
+		},
+	}
+
+	command.Flags().BoolVar(&allowDataChanges, "allow-data-changes", false, "write the migration even though it does not include the changes to stored records")
+
+	return command
+}
+
+func newPruneCommand(app core.App, vAll *viper.Viper) *cobra.Command {
+	var dryRun bool
+
+	command := &cobra.Command{
+		Use:          "prune",
+		Short:        "Delete every retired collection and field, whether or not the grace period is over",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := vAll.Sub("collections")
+			if v == nil {
+				v = viper.New()
+			}
+
+			changes, err := PruneRetired(app, v, dryRun)
+			if err != nil {
+				return err
+			}
+
+			changes.Print(cmd.OutOrStdout())
+			return nil
+		},
+	}
+
+	command.Flags().BoolVar(&dryRun, "dry-run", false, "print the retired collections and fields without deleting them")
+
+	return command
+}
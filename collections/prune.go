@@ -0,0 +1,211 @@
+package collections
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/viper"
+)
+
+const (
+	PruneModeDelete = "delete"
+	PruneModeRetire = "retire"
+)
+
+// retiredDateFormat is the format of the date added to the names of retired
+// collections and fields.
+const retiredDateFormat = "20060102"
+
+// PruneConfig controls what happens to collections and fields that are no
+// longer in the configuration. In retire mode they are renamed with the retire
+// prefix and the current date, and only deleted once the grace period is over
+// (or by the "collections prune" command). A grace period of 0 days means they
+// are only deleted by the command.
+type PruneConfig struct {
+	Mode         string `mapstructure:"mode" json:"mode,omitempty"`
+	RetirePrefix string `mapstructure:"retire_prefix" json:"retire_prefix,omitempty"`
+	GraceDays    int    `mapstructure:"grace_days" json:"grace_days,omitempty"`
+}
+
+func setPruneDefaults(v *viper.Viper) {
+	v.SetDefault("prune.mode", PruneModeDelete)
+	v.SetDefault("prune.retire_prefix", "_retired_")
+	v.SetDefault("prune.grace_days", 0)
+}
+
+func (prune *PruneConfig) validate() error {
+	if prune.Mode != PruneModeDelete && prune.Mode != PruneModeRetire {
+		return fmt.Errorf("invalid prune mode %s", prune.Mode)
+	}
+	if prune.RetirePrefix == "" {
+		return errors.New("the retire prefix cannot be empty")
+	}
+	return nil
+}
+
+// retiredName returns the name given to a collection or field when it is retired.
+func (prune *PruneConfig) retiredName(name string) string {
+	return prune.RetirePrefix + time.Now().Format(retiredDateFormat) + "_" + name
+}
+
+// retiredAt returns the date a collection or field was retired, and false if
+// the name is not a retired name.
+func (prune *PruneConfig) retiredAt(name string) (time.Time, bool) {
+	if prune == nil || !strings.HasPrefix(name, prune.RetirePrefix) {
+		return time.Time{}, false
+	}
+
+	date, _, found := strings.Cut(strings.TrimPrefix(name, prune.RetirePrefix), "_")
+	if !found {
+		return time.Time{}, false
+	}
+
+	retiredAt, err := time.Parse(retiredDateFormat, date)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return retiredAt, true
+}
+
+// originalName returns the name a collection or field had before it was
+// retired, or the name itself if it is not a retired name.
+func (prune *PruneConfig) originalName(name string) string {
+	if _, retired := prune.retiredAt(name); !retired {
+		return name
+	}
+
+	_, original, _ := strings.Cut(strings.TrimPrefix(name, prune.RetirePrefix), "_")
+	return original
+}
+
+// expired reports whether the grace period for something retired at the given
+// date is over.
+func (prune *PruneConfig) expired(retiredAt time.Time) bool {
+	if prune.GraceDays <= 0 {
+		return false
+	}
+	return time.Since(retiredAt) >= time.Duration(prune.GraceDays)*24*time.Hour
+}
+
+// retireCollection renames the collection with the retire prefix and removes
+// its API rules so that only superusers can access it.
+func retireCollection(app core.App, collection *core.Collection, prune *PruneConfig) error {
+	collection.Name = prune.retiredName(collection.Name)
+	collection.ListRule = nil
+	collection.ViewRule = nil
+	collection.CreateRule = nil
+	collection.UpdateRule = nil
+	collection.DeleteRule = nil
+	if collection.Type == core.CollectionTypeAuth {
+		collection.AuthRule = nil
+		collection.ManageRule = nil
+	}
+
+	return app.Save(collection)
+}
+
+// retireField renames the field with the retire prefix, hides it and makes it
+// optional, so that it no longer affects the API.
+func retireField(collection *core.Collection, field core.Field, prune *PruneConfig, changes *ChangeLog) error {
+	raw, err := json.Marshal(field)
+	if err != nil {
+		return err
+	}
+
+	var settings map[string]any
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		return err
+	}
+
+	settings["name"] = prune.retiredName(field.GetName())
+	settings["hidden"] = true
+	if _, ok := settings["required"]; ok {
+		settings["required"] = false
+	}
+
+	if raw, err = json.Marshal(settings); err != nil {
+		return err
+	}
+
+	removeFieldIndexes(collection, field.GetName(), changes)
+	return json.Unmarshal(raw, field)
+}
+
+// PruneRetired deletes every retired collection and field, whether or not the
+// grace period is over. When dryRun is set the changes are rolled back.
+func PruneRetired(app core.App, v *viper.Viper, dryRun bool) (*ChangeLog, error) {
+
+	setPruneDefaults(v)
+
+	prune := &PruneConfig{}
+	if err := v.UnmarshalKey("prune", prune); err != nil {
+		return nil, fmt.Errorf("failed to read prune configuration: %w", err)
+	}
+
+	var collectionConfigs []CollectionConfig
+	if err := v.UnmarshalKey("collections", &collectionConfigs); err != nil {
+		return nil, fmt.Errorf("failed to read collections configuration: %w", err)
+	}
+
+	// Retired fields matching keep_fields are not deleted.
+	keepFields := map[string][]collectionPattern{}
+	for _, collectionConfig := range collectionConfigs {
+		patterns, err := compileCollectionPatterns(collectionConfig.KeepFields)
+		if err != nil {
+			return nil, fmt.Errorf("collection %s has invalid keep_fields: %w", collectionConfig.Name, err)
+		}
+		keepFields[collectionConfig.Name] = patterns
+	}
+
+	changes := &ChangeLog{DryRun: dryRun}
+
+	err := reconcileInTransaction(app, !dryRun, func(txApp core.App) error {
+		collections, err := txApp.FindAllCollections()
+		if err != nil {
+			return fmt.Errorf("failed to find collections: %w", err)
+		}
+
+		report := &ReconcileReport{}
+
+		for _, collection := range collections {
+			if _, retired := prune.retiredAt(collection.Name); retired {
+				changes.record(ChangeDelete, "collection", collection.Name, "", "retired")
+				report.add(collection.Name, "", "remove collection", txApp.Delete(collection))
+				continue
+			}
+
+			var retiredFields []core.Field
+			for _, field := range collection.Fields {
+				if matchCollectionPatterns(keepFields[collection.Name], prune.originalName(field.GetName())) {
+					continue
+				}
+				if _, retired := prune.retiredAt(field.GetName()); retired && !field.GetSystem() {
+					retiredFields = append(retiredFields, field)
+				}
+			}
+
+			if len(retiredFields) == 0 {
+				continue
+			}
+
+			for _, field := range retiredFields {
+				changes.record(ChangeDelete, "field", collection.Name, field.GetName(), "retired")
+				removeFieldIndexes(collection, field.GetName(), changes)
+				collection.Fields.RemoveById(field.GetId())
+			}
+			report.add(collection.Name, "", "remove fields", txApp.Save(collection))
+		}
+
+		return report.err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
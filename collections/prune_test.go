@@ -0,0 +1,25 @@
+package collections
+
+import "testing"
+
+func TestPruneOriginalName(t *testing.T) {
+	prune := &PruneConfig{Mode: PruneModeRetire, RetirePrefix: "_retired_"}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "title", want: "title"},
+		{name: "_retired_20240131_title", want: "title"},
+		{name: "_retired_20240131_legacy_notes", want: "legacy_notes"},
+		{name: "_retired_notadate_title", want: "_retired_notadate_title"},
+		{name: "_retired_20240131", want: "_retired_20240131"},
+		{name: "retired_20240131_title", want: "retired_20240131_title"},
+	}
+
+	for _, test := range tests {
+		if got := prune.originalName(test.name); got != test.want {
+			t.Errorf("originalName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package collections
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"pocketforge/config"
+)
+
+// ReconcileError records a single failure while reconciling the collections
+// configuration, along with the collection, field and operation involved.
+type ReconcileError struct {
+	Collection string
+	Field      string
+	Operation  string
+	Err        error
+}
+
+func (e *ReconcileError) Error() string {
+	target := e.Collection
+	if e.Field != "" {
+		target = e.Collection + "." + e.Field
+	}
+
+	if target == "" {
+		return fmt.Sprintf("%s: %v", e.Operation, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Operation, target, e.Err)
+}
+
+func (e *ReconcileError) Unwrap() error {
+	return e.Err
+}
+
+// ReconcileReport aggregates every failure from a reconciliation run so they
+// can be reported together.
+type ReconcileReport struct {
+	Errors []*ReconcileError
+}
+
+// add records err against the collection, field and operation. Errors that are
+// already a ReconcileError or ReconcileReport keep their own details. A nil err
+// is ignored.
+func (report *ReconcileReport) add(collection string, field string, operation string, err error) {
+	if err == nil {
+		return
+	}
+
+	var nestedReport *ReconcileReport
+	if errors.As(err, &nestedReport) {
+		report.Errors = append(report.Errors, nestedReport.Errors...)
+		return
+	}
+
+	var reconcileError *ReconcileError
+	if errors.As(err, &reconcileError) {
+		report.Errors = append(report.Errors, reconcileError)
+		return
+	}
+
+	report.Errors = append(report.Errors, &ReconcileError{
+		Collection: collection,
+		Field:      field,
+		Operation:  operation,
+		Err:        err,
+	})
+}
+
+// err returns the report as an error, or nil if nothing failed.
+func (report *ReconcileReport) err() error {
+	if len(report.Errors) == 0 {
+		return nil
+	}
+	return report
+}
+
+func (report *ReconcileReport) Error() string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "%d problem(s) found in the collections configuration:", len(report.Errors))
+	for _, err := range report.Errors {
+		fmt.Fprintf(&builder, "\n  - %s", err)
+	}
+
+	return config.Redact(builder.String())
+}
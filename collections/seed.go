@@ -0,0 +1,214 @@
+package collections
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"gopkg.in/yaml.v3"
+
+	"pocketforge/config"
+)
+
+// SeedConfig lists records that are created, or updated, once the collections
+// have been configured. Records are matched to existing records by the key
+// field, so the same records can be seeded on every start.
+type SeedConfig struct {
+	Key     string           `mapstructure:"key" json:"key,omitempty"`
+	Records []map[string]any `mapstructure:"records" json:"records,omitempty"`
+	File    string           `mapstructure:"file" json:"file,omitempty"`
+}
+
+// seedRecords upserts the seed records of the collection.
+func (configuration *CollectionConfig) seedRecords(app core.App) error {
+
+	if configuration.Seed == nil {
+		return nil
+	}
+
+	collection, err := configuration.refreshCollection(app)
+	if err != nil {
+		return err
+	}
+
+	key := configuration.Seed.Key
+	if key == "" {
+		key = "id"
+	}
+	keyField := seedField(collection, key)
+	if keyField == nil {
+		return fmt.Errorf("unknown seed key field %s", key)
+	}
+	key = keyField.GetName()
+
+	records, err := configuration.Seed.load()
+	if err != nil {
+		return err
+	}
+
+	report := &ReconcileReport{}
+
+	for i, data := range records {
+		data, err := seedFieldValues(collection, data)
+		if err != nil {
+			report.add(configuration.Name, "", "seed records", fmt.Errorf("record %d: %w", i+1, err))
+			continue
+		}
+
+		value, ok := data[key]
+		if !ok || value == nil || value == "" {
+			report.add(configuration.Name, "", "seed records", fmt.Errorf("record %d has no %s", i+1, key))
+			continue
+		}
+
+		if err := seedRecord(app, collection, key, value, data, configuration.changes); err != nil {
+			report.add(configuration.Name, "", "seed records", fmt.Errorf("record %s=%v: %w", key, value, err))
+		}
+	}
+
+	return report.err()
+}
+
+func seedRecord(app core.App, collection *core.Collection, key string, value any, data map[string]any, changes *ChangeLog) error {
+
+	var record *core.Record
+	var err error
+	if key == "id" {
+		record, err = app.FindRecordById(collection, fmt.Sprint(value))
+	} else {
+		record, err = app.FindFirstRecordByFilter(collection, key+" = {:value}", dbx.Params{"value": value})
+	}
+
+	isNew := false
+	if errors.Is(err, sql.ErrNoRows) {
+		record = core.NewRecord(collection)
+		isNew = true
+	} else if err != nil {
+		return err
+	}
+
+	var changed []string
+	for name, fieldValue := range data {
+		field := collection.Fields.GetByName(name)
+
+		// Passwords are only set on new records, as the stored hash cannot be compared.
+		if !isNew && field.Type() == core.FieldTypePassword {
+			continue
+		}
+
+		before := fmt.Sprint(record.Get(name))
+		record.Set(name, fieldValue)
+		if isNew || fmt.Sprint(record.Get(name)) != before {
+			changed = append(changed, name)
+		}
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	if isNew {
+		changes.recordData(ChangeCreate, "record", collection.Name, fmt.Sprint(value), "")
+	} else {
+		sort.Strings(changed)
+		changes.recordData(ChangeUpdate, "record", collection.Name, fmt.Sprint(value), strings.Join(changed, ", "))
+	}
+
+	return app.Save(record)
+}
+
+// seedField returns the field with the name, ignoring case. The keys of inline
+// seed records are lowercased when the configuration is read, and PocketBase
+// field names are unique regardless of case.
+func seedField(collection *core.Collection, name string) core.Field {
+	if field := collection.Fields.GetByName(name); field != nil {
+		return field
+	}
+
+	for _, field := range collection.Fields {
+		if strings.EqualFold(field.GetName(), name) {
+			return field
+		}
+	}
+
+	return nil
+}
+
+// seedFieldValues returns the record data keyed by the field names of the
+// collection.
+func seedFieldValues(collection *core.Collection, data map[string]any) (map[string]any, error) {
+	values := make(map[string]any, len(data))
+	for name, value := range data {
+		field := seedField(collection, name)
+		if field == nil {
+			return nil, fmt.Errorf("unknown field %s", name)
+		}
+		values[field.GetName()] = value
+	}
+	return values, nil
+}
+
+// load returns the inline records followed by the records from the seed file.
+func (seed *SeedConfig) load() ([]map[string]any, error) {
+
+	records := seed.Records
+
+	if seed.File == "" {
+		return records, nil
+	}
+
+	content, err := os.ReadFile(config.ResolvePath(seed.File))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed file: %w", err)
+	}
+
+	var fileRecords []map[string]any
+	switch strings.ToLower(filepath.Ext(seed.File)) {
+	case ".json":
+		err = json.Unmarshal(content, &fileRecords)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &fileRecords)
+	case ".csv":
+		fileRecords, err = readCSVRecords(content)
+	default:
+		return nil, fmt.Errorf("unsupported seed file type %s", seed.File)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse seed file %s: %w", seed.File, err)
+	}
+
+	return append(records, fileRecords...), nil
+}
+
+// readCSVRecords reads CSV content with a header row naming the fields.
+func readCSVRecords(content []byte) ([]map[string]any, error) {
+
+	rows, err := csv.NewReader(strings.NewReader(string(content))).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	header := rows[0]
+	records := make([]map[string]any, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := make(map[string]any, len(header))
+		for i, name := range header {
+			record[strings.TrimSpace(name)] = row[i]
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
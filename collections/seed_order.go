@@ -0,0 +1,117 @@
+package collections
+
+import "strings"
+
+// seedDependencies returns the lower case names (or ids) of the collections
+// that have to be seeded before the collection: the collections its select
+// values are loaded from and the collections its relations refer to.
+func (configuration *CollectionConfig) seedDependencies() []string {
+	var dependencies []string
+	for _, field := range configuration.Fields {
+		if field.ValuesFrom != nil {
+			dependencies = append(dependencies, strings.ToLower(field.ValuesFrom.Collection))
+		}
+		if field.Type == "relation" {
+			if field.Collection != "" {
+				dependencies = append(dependencies, strings.ToLower(field.Collection))
+			}
+			if field.CollectionId != "" {
+				dependencies = append(dependencies, strings.ToLower(field.CollectionId))
+			}
+		}
+	}
+	return dependencies
+}
+
+// seedOrder returns the configured collections, other than views, ordered so
+// that every collection comes after the collections it depends on (see
+// seedDependencies). Collections that depend on each other, such as two
+// collections with relations to each other, are kept in configuration order.
+func seedOrder(collectionConfigs []CollectionConfig) []*CollectionConfig {
+
+	byName := map[string]*CollectionConfig{}
+	for i := range collectionConfigs {
+		collectionConfig := &collectionConfigs[i]
+		if collectionConfig.Type == "view" {
+			continue
+		}
+		byName[strings.ToLower(collectionConfig.Name)] = collectionConfig
+		if collectionConfig.ID != "" {
+			byName[strings.ToLower(collectionConfig.ID)] = collectionConfig
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[*CollectionConfig]int{}
+	ordered := make([]*CollectionConfig, 0, len(collectionConfigs))
+
+	var visit func(collectionConfig *CollectionConfig)
+	visit = func(collectionConfig *CollectionConfig) {
+		if state[collectionConfig] != 0 {
+			return
+		}
+
+		state[collectionConfig] = visiting
+		for _, dependency := range collectionConfig.seedDependencies() {
+			if dependencyConfig, ok := byName[dependency]; ok {
+				visit(dependencyConfig)
+			}
+		}
+		state[collectionConfig] = visited
+
+		ordered = append(ordered, collectionConfig)
+	}
+
+	for i := range collectionConfigs {
+		if collectionConfigs[i].Type != "view" {
+			visit(&collectionConfigs[i])
+		}
+	}
+
+	return ordered
+}
+
+// valuesSources returns the collections (in seed order) that select values are
+// loaded from, along with the collections they depend on, so that they can be
+// seeded before the select fields are updated.
+func valuesSources(ordered []*CollectionConfig) map[*CollectionConfig]bool {
+
+	byName := map[string]*CollectionConfig{}
+	for _, collectionConfig := range ordered {
+		byName[strings.ToLower(collectionConfig.Name)] = collectionConfig
+		if collectionConfig.ID != "" {
+			byName[strings.ToLower(collectionConfig.ID)] = collectionConfig
+		}
+	}
+
+	sources := map[*CollectionConfig]bool{}
+
+	var add func(collectionConfig *CollectionConfig)
+	add = func(collectionConfig *CollectionConfig) {
+		if sources[collectionConfig] {
+			return
+		}
+		sources[collectionConfig] = true
+		for _, dependency := range collectionConfig.seedDependencies() {
+			if dependencyConfig, ok := byName[dependency]; ok {
+				add(dependencyConfig)
+			}
+		}
+	}
+
+	for _, collectionConfig := range ordered {
+		for _, field := range collectionConfig.Fields {
+			if field.ValuesFrom == nil {
+				continue
+			}
+			if source, ok := byName[strings.ToLower(field.ValuesFrom.Collection)]; ok {
+				add(source)
+			}
+		}
+	}
+
+	return sources
+}
@@ -0,0 +1,50 @@
+package collections
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSeedOrder(t *testing.T) {
+	collectionConfigs := []CollectionConfig{
+		{ID: "p", Name: "posts", Fields: []FieldConfig{
+			{Name: "author", Type: "relation", Collection: "authors"},
+			{Name: "category", Type: "select", ValuesFrom: &SelectValuesSource{Collection: "Categories", Field: "name"}},
+		}},
+		{ID: "a", Name: "authors", Fields: []FieldConfig{
+			{Name: "best_post", Type: "relation", CollectionId: "p"},
+		}},
+		{ID: "v", Name: "post_counts", Type: "view"},
+		{ID: "c", Name: "categories", Fields: []FieldConfig{
+			{Name: "parent", Type: "relation", Collection: "categories"},
+			{Name: "group", Type: "relation", Collection: "groups"},
+		}},
+		{ID: "g", Name: "groups"},
+		{ID: "u", Name: "users"},
+	}
+
+	ordered := seedOrder(collectionConfigs)
+
+	var names []string
+	for _, collectionConfig := range ordered {
+		names = append(names, collectionConfig.Name)
+	}
+	// posts and authors refer to each other, so the cycle is broken where it
+	// is found and authors (reached from posts) comes first.
+	want := []string{"authors", "groups", "categories", "posts", "users"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("seedOrder() = %v, want %v", names, want)
+	}
+
+	var sourceNames []string
+	sources := valuesSources(ordered)
+	for _, collectionConfig := range ordered {
+		if sources[collectionConfig] {
+			sourceNames = append(sourceNames, collectionConfig.Name)
+		}
+	}
+	wantSources := []string{"groups", "categories"}
+	if !reflect.DeepEqual(sourceNames, wantSources) {
+		t.Errorf("valuesSources() = %v, want %v", sourceNames, wantSources)
+	}
+}
@@ -1,123 +1,231 @@
 package collections
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"strings"
 
-	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/tools/types"
 )
 
 type FieldConfig struct {
-	Type                string  `mapstructure:"type" json:"type"`
-	Id                  string  `mapstructure:"id" json:"id"`
-	Name                string  `mapstructure:"name" json:"name"`
-	Required            bool    `mapstructure:"required" json:"required"`
-	Hidden              bool    `mapstructure:"hidden" json:"hidden"`
-	Min                 int     `mapstructure:"min" json:"min"`
-	Max                 int     `mapstructure:"max" json:"max"`
-	MinFloat            float64 `mapstructure:"min_float" json:"min_float"`
-	MaxFloat            float64 `mapstructure:"max_float" json:"max_float"`
-	MaxSize             int64   `mapstructure:"max_size" json:"max_size"`
-	Presentable         bool    `mapstructure:"presentable" json:"presentable"`
-	Pattern             string  `mapstructure:"pattern" json:"pattern"`
-	AutogeneratePattern string  `mapstructure:"autogenerate_pattern" json:"autogenerate_pattern"`
-	OnCreate            bool    `mapstructure:"on_create" json:"on_create"`
-	OnUpdate            bool    `mapstructure:"on_update" json:"on_update"`
-	OnlyInt             bool    `mapstructure:"only_int" json:"only_int"`
-	MinSelect           int     `mapstructure:"min_select" json:"min_select"`
-	MaxSelect           int     `mapstructure:"max_select" json:"max_select"`
+	Type                string  `mapstructure:"type" json:"type,omitempty"`
+	Id                  string  `mapstructure:"id" json:"id,omitempty"`
+	Name                string  `mapstructure:"name" json:"name,omitempty"`
+	RenamedFrom         string  `mapstructure:"renamed_from" json:"renamed_from,omitempty"`
+	Required            bool    `mapstructure:"required" json:"required,omitempty"`
+	Hidden              bool    `mapstructure:"hidden" json:"hidden,omitempty"`
+	Min                 int     `mapstructure:"min" json:"min,omitempty"`
+	Max                 int     `mapstructure:"max" json:"max,omitempty"`
+	MinFloat            float64 `mapstructure:"min_float" json:"min_float,omitempty"`
+	MaxFloat            float64 `mapstructure:"max_float" json:"max_float,omitempty"`
+	MaxSize             int64   `mapstructure:"max_size" json:"max_size,omitempty"`
+	Presentable         bool    `mapstructure:"presentable" json:"presentable,omitempty"`
+	Pattern             string  `mapstructure:"pattern" json:"pattern,omitempty"`
+	AutogeneratePattern string  `mapstructure:"autogenerate_pattern" json:"autogenerate_pattern,omitempty"`
+	OnCreate            bool    `mapstructure:"on_create" json:"on_create,omitempty"`
+	OnUpdate            bool    `mapstructure:"on_update" json:"on_update,omitempty"`
+	OnlyInt             bool    `mapstructure:"only_int" json:"only_int,omitempty"`
+	MinSelect           int     `mapstructure:"min_select" json:"min_select,omitempty"`
+	MaxSelect           int     `mapstructure:"max_select" json:"max_select,omitempty"`
 
 	// File Specific
-	MimeTypes []string `mapstructure:"mime_types" json:"mime_types"`
-	Thumbs    []string `mapstructure:"thumbs" json:"thumbs"`
-	Protected bool     `mapstructure:"protected" json:"protected"`
+	MimeTypes []string `mapstructure:"mime_types" json:"mime_types,omitempty"`
+	Thumbs    []string `mapstructure:"thumbs" json:"thumbs,omitempty"`
+	Protected bool     `mapstructure:"protected" json:"protected,omitempty"`
 
 	// Email and URL Specific
-	ExceptDomains []string `mapstructure:"except_domains" json:"except_domains"`
-	OnlyDomains   []string `mapstructure:"only_domains" json:"only_domains"`
+	ExceptDomains []string `mapstructure:"except_domains" json:"except_domains,omitempty"`
+	OnlyDomains   []string `mapstructure:"only_domains" json:"only_domains,omitempty"`
 
 	// Date Specific
-	MinDate string `mapstructure:"min_date" json:"min_date"`
-	MaxDate string `mapstructure:"max_date" json:"max_date"`
+	MinDate string `mapstructure:"min_date" json:"min_date,omitempty"`
+	MaxDate string `mapstructure:"max_date" json:"max_date,omitempty"`
 
 	// Editor Specific
-	ConvertURLs bool `mapstructure:"convert_urls" json:"convert_urls"`
+	ConvertURLs bool `mapstructure:"convert_urls" json:"convert_urls,omitempty"`
 
 	// Select Specific
-	Values []string `mapstructure:"values" json:"values"`
+	Values       []string            `mapstructure:"values" json:"values,omitempty"`
+	ValuesFile   string              `mapstructure:"values_file" json:"values_file,omitempty"`
+	ValuesFrom   *SelectValuesSource `mapstructure:"values_from" json:"values_from,omitempty"`
+	ValueRenames []ValueRename       `mapstructure:"value_renames" json:"value_renames,omitempty"`
 
 	// Password Specific
-	Cost int `mapstructure:"cost" json:"cost"`
+	Cost int `mapstructure:"cost" json:"cost,omitempty"`
 
 	// Relation Specific
-	CollectionId  string `mapstructure:"collection_id" json:"collection_id"`
-	CascadeDelete bool   `mapstructure:"cascade_delete" json:"cascade_delete"`
+	Collection    string `mapstructure:"collection" json:"collection,omitempty"`
+	CollectionId  string `mapstructure:"collection_id" json:"collection_id,omitempty"`
+	CascadeDelete bool   `mapstructure:"cascade_delete" json:"cascade_delete,omitempty"`
 }
 
-func (f *FieldConfig) CreateOrUpdate(app *pocketbase.PocketBase, collection *core.Collection) {
-	field := f.getExistingField(collection)
+func (f *FieldConfig) CreateOrUpdate(app core.App, collection *core.Collection, changes *ChangeLog) error {
+	if err := f.resolveRelation(app); err != nil {
+		return err
+	}
 
-	if field != nil && field.Type() != f.Type {
-		collection.Fields.RemoveById(f.getId(collection))
-		app.Save(collection)
-		field = nil
+	if err := f.resolveSelectValues(app); err != nil {
+		return err
 	}
 
-	if field == nil {
-		f.createField(app, collection)
+	if err := f.createOrUpdateField(app, collection, changes); err != nil {
+		return err
+	}
+
+	return f.renameSelectValues(app, collection, changes)
+}
+
+func (f *FieldConfig) createOrUpdateField(app core.App, collection *core.Collection, changes *ChangeLog) error {
+	target, err := f.buildField(collection)
+	if err != nil {
+		return err
 	}
 
-	field = f.getExistingField(collection)
+	field := f.getExistingField(collection)
 
 	if field == nil {
-		log.Panicf("Failed to create field %s", f.Name)
+		changes.record(ChangeCreate, "field", collection.Name, f.Name, f.Type)
+		return f.saveField(app, collection, target)
+	}
+
+	details := []string{f.Type}
+	if field.GetName() != f.Name {
+		details = append(details, "renamed from "+field.GetName())
+	}
+
+	if field.Type() != f.Type {
+		return f.changeFieldType(app, collection, field, target, changes, details)
+	}
+
+	// Keep the id of the existing field so that a rename keeps the column and its data.
+	target.SetId(field.GetId())
+	if fieldsEqual(field, target) {
+		return nil
 	}
 
-	//Creating the field actually updates it if the id or name already exists.
-	f.createField(app, collection)
+	if field.GetName() != f.Name {
+		removeFieldIndexes(collection, field.GetName(), changes)
+	}
 
+	changes.record(ChangeUpdate, "field", collection.Name, f.Name, strings.Join(details, ", "))
+	return f.saveField(app, collection, target)
 }
 
-func (f *FieldConfig) createField(app *pocketbase.PocketBase, collection *core.Collection) {
+// resolveRelation looks up the related collection of a relation field by the
+// configured collection name or id, and sets CollectionId to its id.
+func (f *FieldConfig) resolveRelation(app core.App) error {
+	if f.Type != "relation" {
+		return nil
+	}
+
+	if f.Collection != "" && f.CollectionId != "" {
+		return errors.New("only one of collection and collection_id can be set")
+	}
+
+	target := f.Collection
+	if target == "" {
+		target = f.CollectionId
+	}
+	if target == "" {
+		return errors.New("the related collection is not set")
+	}
+
+	related, err := app.FindCollectionByNameOrId(target)
+	if err != nil {
+		return fmt.Errorf("the related collection %s does not exist", target)
+	}
+
+	f.CollectionId = related.Id
+	return nil
+}
+
+// saveField adds the field to the collection and saves it.
+func (f *FieldConfig) saveField(app core.App, collection *core.Collection, field core.Field) error {
+	//Adding the field actually updates it if the id already exists.
+	collection.Fields.Add(field)
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to save field: %w", err)
+	}
+
+	if collection.Fields.GetById(field.GetId()) == nil {
+		return errors.New("field not found after saving")
+	}
+
+	return nil
+}
+
+func (f *FieldConfig) buildField(collection *core.Collection) (core.Field, error) {
 	switch f.Type {
 	case "text":
-		f.createTextField(app, collection)
+		return f.buildTextField(collection), nil
 	case "json":
-		f.createJSONField(app, collection)
+		return f.buildJSONField(collection), nil
 	case "autodate":
-		f.createAutodateField(app, collection)
+		return f.buildAutodateField(collection), nil
 	case "file":
-		f.createFileField(app, collection)
+		return f.buildFileField(collection), nil
 	case "email":
-		f.createEmailField(app, collection)
+		return f.buildEmailField(collection), nil
 	case "url":
-		f.createURLField(app, collection)
+		return f.buildURLField(collection), nil
 	case "date":
-		f.createDateField(app, collection)
+		return f.buildDateField(collection)
 	case "editor":
-		f.createEditorField(app, collection)
+		return f.buildEditorField(collection), nil
 	case "select":
-		f.createSelectField(app, collection)
+		return f.buildSelectField(collection), nil
 	case "password":
-		f.createPasswordField(app, collection)
+		return f.buildPasswordField(collection), nil
 	case "relation":
-		f.createRelationField(app, collection)
+		return f.buildRelationField(collection), nil
 	case "number":
-		f.createNumberField(app, collection)
+		return f.buildNumberField(collection), nil
+	case "bool":
+		return f.buildBoolField(collection), nil
 	default:
-		log.Panicf("Unknown field type %s", f.Type)
+		return nil, fmt.Errorf("unknown field type %s", f.Type)
+	}
+}
+
+// fieldsEqual reports whether two fields have identical settings.
+func fieldsEqual(a core.Field, b core.Field) bool {
+	if a.Type() != b.Type() {
+		return false
 	}
+
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+
+	return bytes.Equal(aJSON, bJSON)
 }
 
+// getExistingField finds the field this configuration refers to. Fields are
+// matched by id, then by the renamed_from name or id, and finally by name.
 func (f *FieldConfig) getExistingField(collection *core.Collection) core.Field {
-	id := f.getId(collection)
-	for _, field := range collection.Fields {
-		if field.GetId() == id {
+	if field := collection.Fields.GetById(f.getId(collection)); field != nil {
+		return field
+	}
+
+	if f.RenamedFrom != "" {
+		if field := collection.Fields.GetById(f.RenamedFrom); field != nil {
+			return field
+		}
+		if field := collection.Fields.GetByName(f.RenamedFrom); field != nil && !field.GetSystem() {
 			return field
 		}
 	}
+
+	if field := collection.Fields.GetByName(f.Name); field != nil && !field.GetSystem() {
+		return field
+	}
+
 	return nil
 }
 
@@ -128,8 +236,8 @@ func (f *FieldConfig) getId(collection *core.Collection) string {
 	return f.Id
 }
 
-func (f *FieldConfig) createTextField(app *pocketbase.PocketBase, collection *core.Collection) {
-	collection.Fields.Add(&core.TextField{
+func (f *FieldConfig) buildTextField(collection *core.Collection) core.Field {
+	return &core.TextField{
 		Id:                  f.getId(collection),
 		Name:                f.Name,
 		Required:            f.Required,
@@ -139,40 +247,34 @@ func (f *FieldConfig) createTextField(app *pocketbase.PocketBase, collection *co
 		Pattern:             f.Pattern,
 		Presentable:         f.Presentable,
 		AutogeneratePattern: f.AutogeneratePattern,
-	})
-
-	app.Save(collection)
+	}
 }
 
-func (f *FieldConfig) createJSONField(app *pocketbase.PocketBase, collection *core.Collection) {
-	collection.Fields.Add(&core.JSONField{
+func (f *FieldConfig) buildJSONField(collection *core.Collection) core.Field {
+	return &core.JSONField{
 		Id:          f.getId(collection),
 		Name:        f.Name,
 		Required:    f.Required,
 		Hidden:      f.Hidden,
 		MaxSize:     f.MaxSize,
 		Presentable: f.Presentable,
-	})
-
-	app.Save(collection)
+	}
 }
 
-func (f *FieldConfig) createAutodateField(app *pocketbase.PocketBase, collection *core.Collection) {
+func (f *FieldConfig) buildAutodateField(collection *core.Collection) core.Field {
 
-	collection.Fields.Add(&core.AutodateField{
+	return &core.AutodateField{
 		Id:          f.getId(collection),
 		Name:        f.Name,
 		OnCreate:    f.OnCreate,
 		OnUpdate:    f.OnUpdate,
 		Hidden:      f.Hidden,
 		Presentable: f.Presentable,
-	})
-
-	app.Save(collection)
+	}
 }
 
-func (f *FieldConfig) createFileField(app *pocketbase.PocketBase, collection *core.Collection) {
-	collection.Fields.Add(&core.FileField{
+func (f *FieldConfig) buildFileField(collection *core.Collection) core.Field {
+	return &core.FileField{
 		Id:          f.getId(collection),
 		Name:        f.Name,
 		Required:    f.Required,
@@ -183,13 +285,11 @@ func (f *FieldConfig) createFileField(app *pocketbase.PocketBase, collection *co
 		Protected:   f.Protected,
 		MimeTypes:   f.MimeTypes,
 		Thumbs:      f.Thumbs,
-	})
-
-	app.Save(collection)
+	}
 }
 
-func (f *FieldConfig) createEmailField(app *pocketbase.PocketBase, collection *core.Collection) {
-	collection.Fields.Add(&core.EmailField{
+func (f *FieldConfig) buildEmailField(collection *core.Collection) core.Field {
+	return &core.EmailField{
 		Id:            f.getId(collection),
 		Name:          f.Name,
 		Required:      f.Required,
@@ -197,13 +297,11 @@ func (f *FieldConfig) createEmailField(app *pocketbase.PocketBase, collection *c
 		Presentable:   f.Presentable,
 		ExceptDomains: f.ExceptDomains,
 		OnlyDomains:   f.OnlyDomains,
-	})
-
-	app.Save(collection)
+	}
 }
 
-func (f *FieldConfig) createURLField(app *pocketbase.PocketBase, collection *core.Collection) {
-	collection.Fields.Add(&core.URLField{
+func (f *FieldConfig) buildURLField(collection *core.Collection) core.Field {
+	return &core.URLField{
 		Id:            f.getId(collection),
 		Name:          f.Name,
 		Required:      f.Required,
@@ -211,24 +309,22 @@ func (f *FieldConfig) createURLField(app *pocketbase.PocketBase, collection *cor
 		Presentable:   f.Presentable,
 		ExceptDomains: f.ExceptDomains,
 		OnlyDomains:   f.OnlyDomains,
-	})
-
-	app.Save(collection)
+	}
 }
 
-func (f *FieldConfig) createDateField(app *pocketbase.PocketBase, collection *core.Collection) {
+func (f *FieldConfig) buildDateField(collection *core.Collection) (core.Field, error) {
 
 	maxDateTime, err := types.ParseDateTime(f.MaxDate)
 	if err != nil {
-		log.Panicf("Failed to parse MaxDate %s: %v", f.MaxDate, err)
+		return nil, fmt.Errorf("failed to parse max_date %s: %w", f.MaxDate, err)
 	}
 
 	minDateTime, err := types.ParseDateTime(f.MinDate)
 	if err != nil {
-		log.Panicf("Failed to parse MinDate %s: %v", f.MinDate, err)
+		return nil, fmt.Errorf("failed to parse min_date %s: %w", f.MinDate, err)
 	}
 
-	collection.Fields.Add(&core.DateField{
+	return &core.DateField{
 		Id:          f.getId(collection),
 		Name:        f.Name,
 		Required:    f.Required,
@@ -236,13 +332,11 @@ func (f *FieldConfig) createDateField(app *pocketbase.PocketBase, collection *co
 		Min:         minDateTime,
 		Max:         maxDateTime,
 		Presentable: f.Presentable,
-	})
-
-	app.Save(collection)
+	}, nil
 }
 
-func (f *FieldConfig) createEditorField(app *pocketbase.PocketBase, collection *core.Collection) {
-	collection.Fields.Add(&core.EditorField{
+func (f *FieldConfig) buildEditorField(collection *core.Collection) core.Field {
+	return &core.EditorField{
 		Id:          f.getId(collection),
 		Name:        f.Name,
 		Required:    f.Required,
@@ -250,13 +344,11 @@ func (f *FieldConfig) createEditorField(app *pocketbase.PocketBase, collection *
 		Presentable: f.Presentable,
 		MaxSize:     f.MaxSize,
 		ConvertURLs: f.ConvertURLs,
-	})
-
-	app.Save(collection)
+	}
 }
 
-func (f *FieldConfig) createSelectField(app *pocketbase.PocketBase, collection *core.Collection) {
-	collection.Fields.Add(&core.SelectField{
+func (f *FieldConfig) buildSelectField(collection *core.Collection) core.Field {
+	return &core.SelectField{
 		Id:          f.getId(collection),
 		Name:        f.Name,
 		Required:    f.Required,
@@ -264,13 +356,11 @@ func (f *FieldConfig) createSelectField(app *pocketbase.PocketBase, collection *
 		Presentable: f.Presentable,
 		Values:      f.Values,
 		MaxSelect:   f.MaxSelect,
-	})
-
-	app.Save(collection)
+	}
 }
 
-func (f *FieldConfig) createPasswordField(app *pocketbase.PocketBase, collection *core.Collection) {
-	collection.Fields.Add(&core.PasswordField{
+func (f *FieldConfig) buildPasswordField(collection *core.Collection) core.Field {
+	return &core.PasswordField{
 		Id:          f.getId(collection),
 		Name:        f.Name,
 		Required:    f.Required,
@@ -280,13 +370,11 @@ func (f *FieldConfig) createPasswordField(app *pocketbase.PocketBase, collection
 		Pattern:     f.Pattern,
 		Min:         f.Min,
 		Max:         f.Max,
-	})
-
-	app.Save(collection)
+	}
 }
 
-func (f *FieldConfig) createRelationField(app *pocketbase.PocketBase, collection *core.Collection) {
-	collection.Fields.Add(&core.RelationField{
+func (f *FieldConfig) buildRelationField(collection *core.Collection) core.Field {
+	return &core.RelationField{
 		Id:            f.getId(collection),
 		Name:          f.Name,
 		Required:      f.Required,
@@ -296,13 +384,11 @@ func (f *FieldConfig) createRelationField(app *pocketbase.PocketBase, collection
 		CascadeDelete: f.CascadeDelete,
 		MinSelect:     f.MinSelect,
 		MaxSelect:     f.MaxSelect,
-	})
-
-	app.Save(collection)
+	}
 }
 
-func (f *FieldConfig) createNumberField(app *pocketbase.PocketBase, collection *core.Collection) {
-	collection.Fields.Add(&core.NumberField{
+func (f *FieldConfig) buildNumberField(collection *core.Collection) core.Field {
+	return &core.NumberField{
 		Id:          f.getId(collection),
 		Name:        f.Name,
 		Required:    f.Required,
@@ -311,7 +397,15 @@ func (f *FieldConfig) createNumberField(app *pocketbase.PocketBase, collection *
 		Min:         &f.MinFloat,
 		Max:         &f.MaxFloat,
 		OnlyInt:     f.OnlyInt,
-	})
+	}
+}
 
-	app.Save(collection)
+func (f *FieldConfig) buildBoolField(collection *core.Collection) core.Field {
+	return &core.BoolField{
+		Id:          f.getId(collection),
+		Name:        f.Name,
+		Required:    f.Required,
+		Hidden:      f.Hidden,
+		Presentable: f.Presentable,
+	}
 }
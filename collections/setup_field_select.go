@@ -0,0 +1,179 @@
+package collections
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"gopkg.in/yaml.v3"
+
+	"pocketforge/config"
+)
+
+// SelectValuesSource loads the values of a select field from the records of
+// another collection when the configuration is applied.
+type SelectValuesSource struct {
+	Collection string `mapstructure:"collection" json:"collection"`
+	Field      string `mapstructure:"field" json:"field"`
+	Filter     string `mapstructure:"filter" json:"filter,omitempty"`
+	Sort       string `mapstructure:"sort" json:"sort,omitempty"`
+}
+
+// ValueRename renames a select value, updating the records that store it. It
+// is a list rather than a map as configuration map keys are lowercased.
+type ValueRename struct {
+	From string `mapstructure:"from" json:"from"`
+	To   string `mapstructure:"to" json:"to"`
+}
+
+// resolveSelectValues adds the values from the values file and the values
+// collection to the configured values, skipping duplicates.
+func (f *FieldConfig) resolveSelectValues(app core.App) error {
+	if f.Type != "select" {
+		return nil
+	}
+
+	values := slices.Clone(f.Values)
+
+	if f.ValuesFile != "" {
+		fileValues, err := readValuesFile(config.ResolvePath(f.ValuesFile))
+		if err != nil {
+			return err
+		}
+		values = append(values, fileValues...)
+	}
+
+	if f.ValuesFrom != nil {
+		collectionValues, err := f.ValuesFrom.load(app)
+		if err != nil {
+			return err
+		}
+		values = append(values, collectionValues...)
+	}
+
+	f.Values = make([]string, 0, len(values))
+	for _, value := range values {
+		if value != "" && !slices.Contains(f.Values, value) {
+			f.Values = append(f.Values, value)
+		}
+	}
+
+	if len(f.Values) == 0 && f.ValuesFrom != nil {
+		return fmt.Errorf("the select field has no values, as the values collection %s has no matching records", f.ValuesFrom.Collection)
+	}
+
+	for _, rename := range f.ValueRenames {
+		if !slices.Contains(f.Values, rename.To) {
+			return fmt.Errorf("the renamed value %s is not one of the values", rename.To)
+		}
+	}
+
+	return nil
+}
+
+// readValuesFile reads a JSON or YAML list of values, or a text file with one
+// value per line.
+func readValuesFile(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values file: %w", err)
+	}
+
+	var values []string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(content, &values)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &values)
+	default:
+		for _, line := range strings.Split(string(content), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				values = append(values, line)
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse values file %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+// load returns the values of the field in the matching records.
+func (source *SelectValuesSource) load(app core.App) ([]string, error) {
+	collection, err := app.FindCollectionByNameOrId(source.Collection)
+	if err != nil {
+		return nil, fmt.Errorf("the values collection %s does not exist", source.Collection)
+	}
+
+	if collection.Fields.GetByName(source.Field) == nil {
+		return nil, fmt.Errorf("the values collection %s has no field %s", source.Collection, source.Field)
+	}
+
+	filter := source.Filter
+	if filter == "" {
+		filter = `id != ""`
+	}
+	sortBy := source.Sort
+	if sortBy == "" {
+		sortBy = source.Field
+	}
+
+	records, err := app.FindRecordsByFilter(collection, filter, sortBy, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load values from %s: %w", source.Collection, err)
+	}
+
+	values := make([]string, 0, len(records))
+	for _, record := range records {
+		values = append(values, record.GetString(source.Field))
+	}
+
+	return values, nil
+}
+
+// renameSelectValues replaces renamed values in the stored records. Renames are
+// only applied once the previous value has been removed from the values, so a
+// rename left in the configuration does not affect a value that is added back.
+func (f *FieldConfig) renameSelectValues(app core.App, collection *core.Collection, changes *ChangeLog) error {
+	if f.Type != "select" || len(f.ValueRenames) == 0 {
+		return nil
+	}
+
+	field, ok := collection.Fields.GetByName(f.Name).(*core.SelectField)
+	if !ok {
+		return nil
+	}
+
+	for _, rename := range f.ValueRenames {
+		if slices.Contains(field.Values, rename.From) {
+			continue
+		}
+
+		query := fmt.Sprintf("UPDATE {{%s}} SET [[%s]] = {:to} WHERE [[%s]] = {:from}", collection.Name, field.Name, field.Name)
+		if field.IsMultiple() {
+			// Multiple select values are stored as JSON arrays.
+			query = fmt.Sprintf(
+				"UPDATE {{%s}} SET [[%s]] = (SELECT json_group_array(DISTINCT CASE WHEN [[value]] = {:from} THEN {:to} ELSE [[value]] END) FROM json_each([[%s]])) "+
+					"WHERE EXISTS (SELECT 1 FROM json_each([[%s]]) WHERE [[value]] = {:from})",
+				collection.Name, field.Name, field.Name, field.Name,
+			)
+		}
+
+		result, err := app.DB().NewQuery(query).Bind(dbx.Params{"from": rename.From, "to": rename.To}).Execute()
+		if err != nil {
+			return fmt.Errorf("failed to rename value %s to %s: %w", rename.From, rename.To, err)
+		}
+
+		if updated, _ := result.RowsAffected(); updated > 0 {
+			changes.recordData(ChangeUpdate, "field", collection.Name, f.Name, fmt.Sprintf("renamed value %s to %s in %d records", rename.From, rename.To, updated))
+		}
+	}
+
+	return nil
+}
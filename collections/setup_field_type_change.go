@@ -0,0 +1,110 @@
+package collections
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// compatibleTypeChanges lists the field type changes that keep existing data.
+// It maps the new type to the previous types it can be converted from, along
+// with the SQL expression used to convert the stored values.
+var compatibleTypeChanges = map[string]map[string]string{
+	"text": {
+		"editor": "[[%s]]",
+		"email":  "[[%s]]",
+		"url":    "[[%s]]",
+		"select": "[[%s]]",
+		"date":   "[[%s]]",
+		"number": "CAST([[%s]] AS TEXT)",
+	},
+	"editor": {
+		"text": "[[%s]]",
+	},
+}
+
+// typeChangeExpression returns the SQL expression converting the values of
+// field to newType, and false if the data cannot be kept.
+func typeChangeExpression(field core.Field, newType string) (string, bool) {
+	// Multiple select values are stored as JSON arrays.
+	if selectField, ok := field.(*core.SelectField); ok && selectField.MaxSelect > 1 {
+		return "", false
+	}
+
+	expression, ok := compatibleTypeChanges[newType][field.Type()]
+	if !ok {
+		return "", false
+	}
+
+	return fmt.Sprintf(expression, field.GetName()), true
+}
+
+// changeFieldType replaces field with target. A field type cannot be changed in
+// place, so for compatible types the data is copied through a temporary field
+// before the previous field is removed. Otherwise the previous field and its
+// data are removed.
+func (f *FieldConfig) changeFieldType(app core.App, collection *core.Collection, field core.Field, target core.Field, changes *ChangeLog, details []string) error {
+	typeChange := fmt.Sprintf("type changed from %s to %s", field.Type(), f.Type)
+
+	expression, compatible := typeChangeExpression(field, f.Type)
+	if !compatible {
+		changes.record(ChangeDelete, "field", collection.Name, field.GetName(), typeChange+", data not preserved")
+		if err := removeField(app, collection, field, changes); err != nil {
+			return err
+		}
+
+		changes.record(ChangeCreate, "field", collection.Name, f.Name, f.Type)
+		return f.saveField(app, collection, target)
+	}
+
+	changes.recordData(ChangeUpdate, "field", collection.Name, f.Name, strings.Join(append(details, typeChange), ", "))
+
+	temporary, err := f.buildField(collection)
+	if err != nil {
+		return err
+	}
+	temporary.SetId(target.GetId() + "_tmp")
+	temporary.SetName("_tmp_" + f.Name)
+
+	if err := f.saveField(app, collection, temporary); err != nil {
+		return err
+	}
+
+	if err := copyFieldData(app, collection, temporary.GetName(), expression); err != nil {
+		return err
+	}
+
+	if err := removeField(app, collection, field, changes); err != nil {
+		return err
+	}
+
+	if err := f.saveField(app, collection, target); err != nil {
+		return err
+	}
+
+	if err := copyFieldData(app, collection, target.GetName(), fmt.Sprintf("[[%s]]", temporary.GetName())); err != nil {
+		return err
+	}
+
+	return removeField(app, collection, temporary, changes)
+}
+
+// removeField removes the field, and any indexes that refer to it, from the collection.
+func removeField(app core.App, collection *core.Collection, field core.Field, changes *ChangeLog) error {
+	removeFieldIndexes(collection, field.GetName(), changes)
+	collection.Fields.RemoveById(field.GetId())
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to remove field %s: %w", field.GetName(), err)
+	}
+	return nil
+}
+
+// copyFieldData sets the column of every record in the collection to expression.
+func copyFieldData(app core.App, collection *core.Collection, column string, expression string) error {
+	query := fmt.Sprintf("UPDATE {{%s}} SET [[%s]] = %s", collection.Name, column, expression)
+	if _, err := app.DB().NewQuery(query).Execute(); err != nil {
+		return fmt.Errorf("failed to copy data into field %s: %w", column, err)
+	}
+	return nil
+}
@@ -1,43 +1,195 @@
 package collections
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/dbutils"
 )
 
 type IndexConfig struct {
-	Fields []string `mapstructure:"fields" json:"fields"`
-	Unique bool     `mapstructure:"unique" json:"unique"`
-	Id     string   `mapstructure:"id" json:"id"`
+	Fields  []string            `mapstructure:"fields" json:"fields,omitempty"`
+	Columns []IndexColumnConfig `mapstructure:"columns" json:"columns,omitempty"`
+	Unique  bool                `mapstructure:"unique" json:"unique,omitempty"`
+	Where   string              `mapstructure:"where" json:"where,omitempty"`
+	Id      string              `mapstructure:"id" json:"id,omitempty"`
+}
+
+// IndexColumnConfig is a single indexed column, given either as a field name or
+// as an SQL expression such as lower(email).
+type IndexColumnConfig struct {
+	Field      string `mapstructure:"field" json:"field,omitempty"`
+	Expression string `mapstructure:"expression" json:"expression,omitempty"`
+	Collate    string `mapstructure:"collate" json:"collate,omitempty"`
+	Sort       string `mapstructure:"sort" json:"sort,omitempty"`
 }
 
 type IndexReturn struct {
 	Name       string `json:"name"`
 	Unique     bool   `json:"unique"`
 	ColumnExpr string `json:"column_expr"`
+	Where      string `json:"where"`
 }
 
-func (i *IndexConfig) getIndexQuery(collection *core.Collection) IndexReturn {
+// identifierPattern matches plain column and collation names.
+var identifierPattern = regexp.MustCompile(`^\w+$`)
 
+func (i *IndexConfig) getIndexQuery(collection *core.Collection) (IndexReturn, error) {
+
+	columns := make([]IndexColumnConfig, 0, len(i.Fields)+len(i.Columns))
 	for _, field := range i.Fields {
-		if collection.Fields.GetByName(field) == nil {
-			log.Panicf("Unknown field %s when configuring indexes on collection %s", field, collection.Name)
-		}
+		columns = append(columns, IndexColumnConfig{Field: field})
 	}
+	columns = append(columns, i.Columns...)
 
-	columns_expr := ""
-	for i, field := range i.Fields {
-		if i > 0 {
-			columns_expr += ", "
+	if len(columns) == 0 {
+		return IndexReturn{}, fmt.Errorf("index %s has no fields or columns", i.Id)
+	}
+
+	columns_expr := make([]string, 0, len(columns))
+	for _, column := range columns {
+		expr, err := column.getColumnExpr(collection)
+		if err != nil {
+			return IndexReturn{}, fmt.Errorf("%w in index %s", err, i.Id)
 		}
-		columns_expr += "`" + field + "`"
+		columns_expr = append(columns_expr, expr)
 	}
 
 	return IndexReturn{
 		Name:       i.Id,
 		Unique:     i.Unique,
-		ColumnExpr: columns_expr,
+		ColumnExpr: strings.Join(columns_expr, ", "),
+		Where:      i.Where,
+	}, nil
+
+}
+
+func (c *IndexColumnConfig) getColumnExpr(collection *core.Collection) (string, error) {
+
+	var expr string
+	switch {
+	case c.Field != "" && c.Expression != "":
+		return "", fmt.Errorf("column %s has both a field and an expression", c.Field)
+	case c.Field != "":
+		if collection.Fields.GetByName(c.Field) == nil {
+			return "", fmt.Errorf("unknown field %s", c.Field)
+		}
+		expr = "`" + c.Field + "`"
+	case c.Expression != "":
+		expr = c.Expression
+	default:
+		return "", errors.New("column without a field or expression")
+	}
+
+	if c.Collate != "" {
+		if !identifierPattern.MatchString(c.Collate) {
+			return "", fmt.Errorf("invalid collation %s", c.Collate)
+		}
+		expr += " COLLATE " + strings.ToUpper(c.Collate)
+	}
+
+	if c.Sort != "" {
+		sort := strings.ToUpper(c.Sort)
+		if sort != "ASC" && sort != "DESC" {
+			return "", fmt.Errorf("invalid sort order %s", c.Sort)
+		}
+		expr += " " + sort
+	}
+
+	return expr, nil
+}
+
+// definition returns the configured index in the form produced by
+// dbutils.ParseIndex, so that it can be compared with an existing index.
+func (i *IndexConfig) definition() dbutils.Index {
+
+	index := dbutils.Index{
+		IndexName: i.Id,
+		Unique:    i.Unique,
+		Where:     i.Where,
+	}
+
+	for _, field := range i.Fields {
+		index.Columns = append(index.Columns, dbutils.IndexColumn{Name: field})
 	}
 
+	for _, column := range i.Columns {
+		name := column.Field
+		if name == "" {
+			name = column.Expression
+		}
+		index.Columns = append(index.Columns, dbutils.IndexColumn{
+			Name:    name,
+			Collate: column.Collate,
+			Sort:    column.Sort,
+		})
+	}
+
+	return index
+}
+
+// indexesEqual reports whether two indexes have the same definition.
+func indexesEqual(a dbutils.Index, b dbutils.Index) bool {
+	if !strings.EqualFold(a.IndexName, b.IndexName) ||
+		a.Unique != b.Unique ||
+		normalizeSQL(a.Where) != normalizeSQL(b.Where) ||
+		len(a.Columns) != len(b.Columns) {
+		return false
+	}
+
+	for i := range a.Columns {
+		if normalizeSQL(a.Columns[i].Name) != normalizeSQL(b.Columns[i].Name) ||
+			!strings.EqualFold(a.Columns[i].Collate, b.Columns[i].Collate) ||
+			!strings.EqualFold(a.Columns[i].Sort, b.Columns[i].Sort) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func normalizeSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+// isSystemIndex reports whether the index only covers system fields of an auth
+// collection (such as the unique email and tokenKey indexes). These indexes are
+// required by PocketBase and are never removed.
+func isSystemIndex(collection *core.Collection, index dbutils.Index) bool {
+	if collection.Type != core.CollectionTypeAuth {
+		return false
+	}
+
+	for _, column := range index.Columns {
+		field := collection.Fields.GetByName(column.Name)
+		if field == nil || !field.GetSystem() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// removeFieldIndexes removes the indexes that refer to the named field, so that
+// the field can be renamed or removed. They are recreated from the configuration
+// by updateIndexes.
+func removeFieldIndexes(collection *core.Collection, fieldName string, changes *ChangeLog) {
+	var indexNames []string
+	for _, indexSQL := range collection.Indexes {
+		index := dbutils.ParseIndex(indexSQL)
+		for _, column := range index.Columns {
+			if strings.EqualFold(column.Name, fieldName) {
+				indexNames = append(indexNames, index.IndexName)
+				break
+			}
+		}
+	}
+
+	for _, indexName := range indexNames {
+		changes.record(ChangeDelete, "index", collection.Name, indexName, "field "+fieldName+" changed")
+		collection.RemoveIndex(indexName)
+	}
 }
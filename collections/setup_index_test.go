@@ -0,0 +1,156 @@
+package collections
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/dbutils"
+)
+
+func TestNormalizeSQL(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{sql: "", want: ""},
+		{sql: "status = 'active'", want: "status = 'active'"},
+		{sql: "  status  =\n\t'active' ", want: "status = 'active'"},
+		{sql: "lower( title )", want: "lower( title )"},
+	}
+
+	for _, test := range tests {
+		if got := normalizeSQL(test.sql); got != test.want {
+			t.Errorf("normalizeSQL(%q) = %q, want %q", test.sql, got, test.want)
+		}
+	}
+}
+
+func TestIndexesEqual(t *testing.T) {
+	base := dbutils.Index{
+		IndexName: "idx_posts_title",
+		Unique:    true,
+		Where:     "status = 'active'",
+		Columns:   []dbutils.IndexColumn{{Name: "title", Collate: "NOCASE", Sort: "ASC"}},
+	}
+
+	tests := []struct {
+		name  string
+		index dbutils.Index
+		want  bool
+	}{
+		{name: "same", index: base, want: true},
+		{
+			name: "name case and whitespace",
+			index: dbutils.Index{
+				IndexName: "IDX_POSTS_TITLE",
+				Unique:    true,
+				Where:     "status  =\n'active'",
+				Columns:   []dbutils.IndexColumn{{Name: "title", Collate: "nocase", Sort: "asc"}},
+			},
+			want: true,
+		},
+		{
+			name: "not unique",
+			index: dbutils.Index{
+				IndexName: "idx_posts_title",
+				Where:     "status = 'active'",
+				Columns:   []dbutils.IndexColumn{{Name: "title", Collate: "NOCASE", Sort: "ASC"}},
+			},
+			want: false,
+		},
+		{
+			name: "different where",
+			index: dbutils.Index{
+				IndexName: "idx_posts_title",
+				Unique:    true,
+				Columns:   []dbutils.IndexColumn{{Name: "title", Collate: "NOCASE", Sort: "ASC"}},
+			},
+			want: false,
+		},
+		{
+			name: "different sort",
+			index: dbutils.Index{
+				IndexName: "idx_posts_title",
+				Unique:    true,
+				Where:     "status = 'active'",
+				Columns:   []dbutils.IndexColumn{{Name: "title", Collate: "NOCASE", Sort: "DESC"}},
+			},
+			want: false,
+		},
+		{
+			name: "extra column",
+			index: dbutils.Index{
+				IndexName: "idx_posts_title",
+				Unique:    true,
+				Where:     "status = 'active'",
+				Columns:   []dbutils.IndexColumn{{Name: "title", Collate: "NOCASE", Sort: "ASC"}, {Name: "created"}},
+			},
+			want: false,
+		},
+	}
+
+	for _, test := range tests {
+		if got := indexesEqual(base, test.index); got != test.want {
+			t.Errorf("%s: indexesEqual() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIndexDefinitionMatchesParsedIndex(t *testing.T) {
+	tests := []struct {
+		sql    string
+		config IndexConfig
+	}{
+		{
+			sql:    "CREATE INDEX `idx_posts_title` ON `posts` (`title`)",
+			config: IndexConfig{Id: "idx_posts_title", Fields: []string{"title"}},
+		},
+		{
+			sql:    "CREATE UNIQUE INDEX `idx_posts_slug` ON `posts` (`slug`, `site`) WHERE `slug` != ''",
+			config: IndexConfig{Id: "idx_posts_slug", Unique: true, Fields: []string{"slug", "site"}, Where: "`slug` != ''"},
+		},
+		{
+			sql: "CREATE INDEX `idx_posts_lower` ON `posts` (lower(title), `created` DESC)",
+			config: IndexConfig{Id: "idx_posts_lower", Columns: []IndexColumnConfig{
+				{Expression: "lower(title)"},
+				{Field: "created", Sort: "DESC"},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		if !indexesEqual(dbutils.ParseIndex(test.sql), test.config.definition()) {
+			t.Errorf("the definition of %s does not match the parsed index", test.sql)
+		}
+	}
+}
+
+func TestIsSystemIndex(t *testing.T) {
+	users := core.NewAuthCollection("users")
+	users.Fields.Add(&core.TextField{Name: "name"})
+	posts := core.NewBaseCollection("posts")
+
+	tests := []struct {
+		name       string
+		collection *core.Collection
+		columns    []string
+		want       bool
+	}{
+		{name: "auth email", collection: users, columns: []string{"email"}, want: true},
+		{name: "auth token key", collection: users, columns: []string{"tokenKey"}, want: true},
+		{name: "auth custom field", collection: users, columns: []string{"name"}, want: false},
+		{name: "auth mixed", collection: users, columns: []string{"email", "name"}, want: false},
+		{name: "auth unknown", collection: users, columns: []string{"lower(email)"}, want: false},
+		{name: "base id", collection: posts, columns: []string{"id"}, want: false},
+	}
+
+	for _, test := range tests {
+		index := dbutils.Index{IndexName: "idx_test"}
+		for _, column := range test.columns {
+			index.Columns = append(index.Columns, dbutils.IndexColumn{Name: column})
+		}
+		if got := isSystemIndex(test.collection, index); got != test.want {
+			t.Errorf("%s: isSystemIndex() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -2,52 +2,58 @@ package collections
 
 import (
 	"fmt"
-	"log"
 	"pocketforge/superuser"
+	"sort"
+	"strings"
 
-	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/dbutils"
 )
 
 type RulesConfig struct {
-	ListRule   *string `mapstructure:"list_rule" json:"list_rule"`
-	ViewRule   *string `mapstructure:"view_rule" json:"view_rule"`
-	CreateRule *string `mapstructure:"create_rule" json:"create_rule"`
-	DeleteRule *string `mapstructure:"delete_rule" json:"delete_rule"`
-	UpdateRule *string `mapstructure:"update_rule" json:"update_rule"`
-	AuthRule   *string `mapstructure:"auth_rule" json:"auth_rule"`
-	ManageRule *string `mapstructure:"manage_rule" json:"manage_rule"`
+	ListRule   *string `mapstructure:"list_rule" json:"list_rule,omitempty"`
+	ViewRule   *string `mapstructure:"view_rule" json:"view_rule,omitempty"`
+	CreateRule *string `mapstructure:"create_rule" json:"create_rule,omitempty"`
+	DeleteRule *string `mapstructure:"delete_rule" json:"delete_rule,omitempty"`
+	UpdateRule *string `mapstructure:"update_rule" json:"update_rule,omitempty"`
+	AuthRule   *string `mapstructure:"auth_rule" json:"auth_rule,omitempty"`
+	ManageRule *string `mapstructure:"manage_rule" json:"manage_rule,omitempty"`
 }
 
 type CollectionConfig struct {
-	ID                       string        `mapstructure:"id" json:"id"`
-	Name                     string        `mapstructure:"name" json:"name"`
-	Type                     string        `mapstructure:"type" json:"type"`
-	Editable                 bool          `mapstructure:"editable" json:"editable"`
-	Rules                    RulesConfig   `mapstructure:"rules" json:"rules"`
-	AddDefaultFields         bool          `mapstructure:"add_default_fields" json:"add_default_fields"`
-	RetainUnconfiguredFields bool          `mapstructure:"retain_unconfigured_fields" json:"retain_unconfigured_fields"`
-	Fields                   []FieldConfig `mapstructure:"fields" json:"fields"`
-	Indexes                  []IndexConfig `mapstructure:"indexes" json:"indexes"`
+	ID                       string        `mapstructure:"id" json:"id,omitempty"`
+	Name                     string        `mapstructure:"name" json:"name,omitempty"`
+	Type                     string        `mapstructure:"type" json:"type,omitempty"`
+	Editable                 bool          `mapstructure:"editable" json:"editable,omitempty"`
+	Rules                    RulesConfig   `mapstructure:"rules" json:"rules,omitempty"`
+	Extends                  string        `mapstructure:"extends" json:"extends,omitempty"`
+	Mixins                   []string      `mapstructure:"mixins" json:"mixins,omitempty"`
+	AddDefaultFields         bool          `mapstructure:"add_default_fields" json:"add_default_fields,omitempty"`
+	RetainUnconfiguredFields bool          `mapstructure:"retain_unconfigured_fields" json:"retain_unconfigured_fields,omitempty"`
+	PruneMode                string        `mapstructure:"prune_mode" json:"prune_mode,omitempty"`
+	KeepFields               []string      `mapstructure:"keep_fields" json:"keep_fields,omitempty"`
+	Fields                   []FieldConfig `mapstructure:"fields" json:"fields,omitempty"`
+	Indexes                  []IndexConfig `mapstructure:"indexes" json:"indexes,omitempty"`
+	Seed                     *SeedConfig   `mapstructure:"seed" json:"seed,omitempty"`
 	collection               *core.Collection
+	changes                  *ChangeLog
+	prune                    *PruneConfig
 
 	//View Specific Options
-	ViewQuery string `mapstructure:"view_query" json:"view_query"`
+	ViewQuery string `mapstructure:"view_query" json:"view_query,omitempty"`
 
 	//Auth Specific Options
-	AuthConfig AuthConfig `mapstructure:"auth_config" json:"auth_config"`
+	AuthConfig *AuthConfig `mapstructure:"auth" json:"auth,omitempty"`
 }
 
-func (configuration *CollectionConfig) CreateOrUpdateCollection(app *pocketbase.PocketBase) {
+func (configuration *CollectionConfig) CreateOrUpdateCollection(app core.App) error {
 
 	if configuration.ID == "" {
-		log.Panicf("Collection %s has no ID", configuration.Name)
-		return
+		return fmt.Errorf("collection %s has no id", configuration.Name)
 	}
 
 	if configuration.Name == "" {
-		log.Panicf("Collection %s has no Title", configuration.ID)
-		return
+		return fmt.Errorf("collection %s has no name", configuration.ID)
 	}
 
 	if configuration.Type == "" {
@@ -55,38 +61,39 @@ func (configuration *CollectionConfig) CreateOrUpdateCollection(app *pocketbase.
 	}
 
 	if configuration.Type != "base" && configuration.Type != "view" && configuration.Type != "auth" {
-		log.Panicf("Collection %s has invalid type %s", configuration.ID, configuration.Type)
-		return
-	}
-
-	if configuration.Type == "base" || configuration.Type == "auth" {
-		configuration.createOrUpdateBaseAuthCollection(app)
+		return fmt.Errorf("collection %s has invalid type %s", configuration.ID, configuration.Type)
 	}
 
+	var err error
 	if configuration.Type == "view" {
-		configuration.createOrUpdateViewCollection(app)
+		err = configuration.createOrUpdateViewCollection(app)
+	} else {
+		err = configuration.createOrUpdateBaseAuthCollection(app)
+	}
+	if err != nil {
+		return err
 	}
 
-	_, err := configuration.refreshCollection(app)
+	_, err = configuration.refreshCollection(app)
 	if err != nil {
-		log.Panicf("Failed to find collection after creation: %v", err)
+		return fmt.Errorf("failed to find collection after creation: %w", err)
 	}
 
+	return nil
 }
 
-func (configuration *CollectionConfig) saveAndRefreshCollection(app *pocketbase.PocketBase) (*core.Collection, error) {
-	err := app.Save(configuration.collection)
-	if err != nil {
-		log.Printf("Failed to save collection %s: %v", configuration.Name, err)
+func (configuration *CollectionConfig) saveAndRefreshCollection(app core.App) (*core.Collection, error) {
+	if err := app.Save(configuration.collection); err != nil {
+		configuration.refreshCollection(app)
+		return nil, err
 	}
 	return configuration.refreshCollection(app)
 }
 
-func (configuration *CollectionConfig) createOrUpdateBaseAuthCollection(app *pocketbase.PocketBase) {
+func (configuration *CollectionConfig) createOrUpdateBaseAuthCollection(app core.App) error {
 
 	if !(configuration.Type == "auth") && !(configuration.Type == "base") {
-		log.Panicf("Collection %s has invalid type %s", configuration.ID, configuration.Type)
-		return
+		return fmt.Errorf("collection %s has invalid type %s", configuration.ID, configuration.Type)
 	}
 
 	collection, err := configuration.getCollection(app)
@@ -98,43 +105,28 @@ func (configuration *CollectionConfig) createOrUpdateBaseAuthCollection(app *poc
 		}
 		configuration.collection.System = false
 		configuration.collection.Id = configuration.ID
+		configuration.changes.record(ChangeCreate, "collection", configuration.Name, "", configuration.Type)
 		_, err := configuration.saveAndRefreshCollection(app)
 		if err != nil {
-			log.Panicf("Failed to create base collection: %v", err)
+			return fmt.Errorf("failed to create collection: %w", err)
 		}
 	} else {
 		configuration.collection = collection
 	}
 
-	collection, err = configuration.getCollection(app)
-	if err != nil {
-		log.Panicf("Base Collection %s not found", configuration.Name)
-	}
-
-	configuration.collection = collection
-
 	if configuration.collection.Type != "base" && configuration.collection.Type != "auth" {
-		app.Delete(configuration.collection)
-		configuration.createOrUpdateBaseAuthCollection(app)
-	}
-
-	if configuration.collection.Name != configuration.Name {
-		configuration.collection.Name = configuration.Name
-		_, err := configuration.saveAndRefreshCollection(app)
-		if err != nil {
-			log.Panicf("Failed to update collection name for collection %s", configuration.Name)
+		configuration.changes.record(ChangeDelete, "collection", configuration.collection.Name, "", fmt.Sprintf("type changed from %s to %s", configuration.collection.Type, configuration.Type))
+		if err := app.Delete(configuration.collection); err != nil {
+			return fmt.Errorf("failed to remove collection with previous type %s: %w", configuration.collection.Type, err)
 		}
+		configuration.collection = nil
+		return configuration.createOrUpdateBaseAuthCollection(app)
 	}
 
-	configuration.updateCollectionSettings(app)
-	configuration.UpdateFields(app)
-	configuration.updateRules(app)
-	configuration.updateIndexes(app)
-	configuration.lockCollection(app)
-
+	return configuration.updateCollectionSettings(app)
 }
 
-func (configuration *CollectionConfig) createOrUpdateViewCollection(app *pocketbase.PocketBase) {
+func (configuration *CollectionConfig) createOrUpdateViewCollection(app core.App) error {
 
 	collection, err := configuration.refreshCollection(app)
 	if err != nil {
@@ -142,61 +134,48 @@ func (configuration *CollectionConfig) createOrUpdateViewCollection(app *pocketb
 		configuration.collection.System = false
 		configuration.collection.Id = configuration.ID
 		configuration.collection.ViewQuery = configuration.ViewQuery
+		configuration.changes.record(ChangeCreate, "collection", configuration.Name, "", configuration.Type)
 		_, err := configuration.saveAndRefreshCollection(app)
 		if err != nil {
-			log.Panicf("Failed to createview collection: %v. Possibly query is incorrect.", err)
+			return fmt.Errorf("failed to create view collection, possibly the query is incorrect: %w", err)
 		}
 	} else {
 		configuration.collection = collection
 	}
 
-	_, err = configuration.refreshCollection(app)
-	if err != nil {
-		log.Println("Failed to find collection after creation", err)
-		log.Panicf("View Collection %s not found", configuration.Name)
-	}
-
 	if configuration.collection.Type != "view" {
-		app.Delete(configuration.collection)
-		configuration.createOrUpdateViewCollection(app)
-	}
-
-	if configuration.collection.ViewQuery != configuration.ViewQuery {
-		configuration.collection.ViewQuery = configuration.ViewQuery
-		_, err := configuration.saveAndRefreshCollection(app)
-		if err != nil {
-			log.Panicf("Failed to update view query for collection %s", configuration.Name)
-		}
-		if configuration.collection.ViewQuery != configuration.ViewQuery {
-			log.Panicf("Failed to update view query for collection %s", configuration.Name)
+		configuration.changes.record(ChangeDelete, "collection", configuration.collection.Name, "", fmt.Sprintf("type changed from %s to view", configuration.collection.Type))
+		if err := app.Delete(configuration.collection); err != nil {
+			return fmt.Errorf("failed to remove collection with previous type %s: %w", configuration.collection.Type, err)
 		}
+		configuration.collection = nil
+		return configuration.createOrUpdateViewCollection(app)
 	}
 
-	if configuration.collection.Name != configuration.Name {
-		configuration.collection.Name = configuration.Name
+	if normalizeSQL(configuration.collection.ViewQuery) != normalizeSQL(configuration.ViewQuery) {
+		configuration.changes.record(ChangeUpdate, "view query", configuration.Name, "", "")
+		configuration.collection.ViewQuery = configuration.ViewQuery
 		_, err := configuration.saveAndRefreshCollection(app)
 		if err != nil {
-			log.Panicf("Failed to update collection name for collection %s", configuration.Name)
+			return fmt.Errorf("failed to update view query: %w", err)
 		}
 	}
 
-	configuration.updateRules(app)
-	configuration.lockCollection(app)
-
+	return configuration.updateCollectionSettings(app)
 }
 
 // getCollection retrieves a collection from the PocketBase application based on the
 // CollectionConfig's ID. If the collection is already cached in the configuration,
 // it returns the cached collection. Otherwise, it attempts to find the collection
 // by its name or ID using the PocketBase instance. If the collection is not found,
-// the function logs a panic with the collection ID.
+// an error naming the collection ID is returned.
 //
 // Parameters:
-//   - app: A pointer to the PocketBase instance.
+//   - app: The PocketBase application (or transaction) instance.
 //
 // Returns:
 //   - A pointer to the core.Collection instance.
-func (configuration *CollectionConfig) getCollection(app *pocketbase.PocketBase) (*core.Collection, error) {
+func (configuration *CollectionConfig) getCollection(app core.App) (*core.Collection, error) {
 	if configuration.collection != nil {
 		return configuration.collection, nil
 	}
@@ -209,7 +188,7 @@ func (configuration *CollectionConfig) getCollection(app *pocketbase.PocketBase)
 	return collection, nil
 }
 
-func (configuration *CollectionConfig) refreshCollection(app *pocketbase.PocketBase) (*core.Collection, error) {
+func (configuration *CollectionConfig) refreshCollection(app core.App) (*core.Collection, error) {
 
 	configuration.collection = nil
 	collection, err := configuration.getCollection(app)
@@ -228,23 +207,26 @@ func (configuration *CollectionConfig) refreshCollection(app *pocketbase.PocketB
 // If the name is updated, the changes are saved back to the PocketBase application.
 //
 // Parameters:
-//   - app: A pointer to the PocketBase application instance.
+//   - app: The PocketBase application (or transaction) instance.
 //
 // Note: This function assumes that the CollectionConfig struct has a method getCollection that retrieves the collection from the PocketBase application.
-func (configuration *CollectionConfig) updateCollectionSettings(app *pocketbase.PocketBase) {
+func (configuration *CollectionConfig) updateCollectionSettings(app core.App) error {
 
 	_, err := configuration.refreshCollection(app)
 	if err != nil {
-		log.Panicf("Failed to find collection: %v", err)
+		return err
 	}
 
 	if configuration.collection.Name != configuration.Name {
+		configuration.changes.record(ChangeUpdate, "collection", configuration.Name, "", "renamed from "+configuration.collection.Name)
 		configuration.collection.Name = configuration.Name
 		_, err := configuration.saveAndRefreshCollection(app)
 		if err != nil {
-			log.Panicf("Failed to update collection name for collection %s", configuration.Name)
+			return fmt.Errorf("failed to update collection name: %w", err)
 		}
 	}
+
+	return nil
 }
 
 // updateRules updates the rules of a collection in the PocketBase application.
@@ -252,7 +234,7 @@ func (configuration *CollectionConfig) updateCollectionSettings(app *pocketbase.
 // in the CollectionConfig and updates the collection if there are any changes.
 //
 // Parameters:
-// - app: A pointer to the PocketBase application instance.
+// - app: The PocketBase application (or transaction) instance.
 //
 // The function checks each rule (ListRule, ViewRule, DeleteRule, CreateRule, UpdateRule)
 // and updates the collection's rules if they differ from the new rules. If the collection
@@ -260,59 +242,51 @@ func (configuration *CollectionConfig) updateCollectionSettings(app *pocketbase.
 //
 // If any rule is updated, the function saves the updated collection in the PocketBase application.
 //
-// The function panics if the collection in the configuration is nil.
-func (configuration *CollectionConfig) updateRules(app *pocketbase.PocketBase) {
+// The function returns an error if the collection cannot be found or saved.
+func (configuration *CollectionConfig) updateRules(app core.App) error {
 
-	if configuration.collection == nil {
-		log.Panicf("Collection %s has no collection", configuration.Name)
+	if _, err := configuration.getCollection(app); err != nil {
+		return err
 	}
 
-	changed := false
+	var changed []string
 
-	if configuration.Rules.ListRule != configuration.collection.ListRule {
-		configuration.collection.ListRule = configuration.Rules.ListRule
-		changed = true
-	}
-	if configuration.Rules.ViewRule != configuration.collection.ViewRule {
-		configuration.collection.ViewRule = configuration.Rules.ViewRule
-		changed = true
-	}
-	if configuration.Rules.DeleteRule != configuration.collection.DeleteRule {
-		configuration.collection.DeleteRule = configuration.Rules.DeleteRule
-		changed = true
-	}
-	if configuration.Rules.CreateRule != configuration.collection.CreateRule {
-		configuration.collection.CreateRule = configuration.Rules.CreateRule
-		changed = true
-	}
-	if configuration.Rules.UpdateRule != configuration.collection.UpdateRule {
-		configuration.collection.UpdateRule = configuration.Rules.UpdateRule
-		changed = true
-	}
+	updateRule(&configuration.collection.ListRule, configuration.Rules.ListRule, "list_rule", &changed)
+	updateRule(&configuration.collection.ViewRule, configuration.Rules.ViewRule, "view_rule", &changed)
+	updateRule(&configuration.collection.DeleteRule, configuration.Rules.DeleteRule, "delete_rule", &changed)
+	updateRule(&configuration.collection.CreateRule, configuration.Rules.CreateRule, "create_rule", &changed)
+	updateRule(&configuration.collection.UpdateRule, configuration.Rules.UpdateRule, "update_rule", &changed)
 
 	if configuration.Type == "auth" {
-		if configuration.Rules.AuthRule != configuration.collection.AuthRule {
-			configuration.collection.AuthRule = configuration.Rules.AuthRule
-			changed = true
-		}
-		if configuration.Rules.ManageRule != configuration.collection.ManageRule {
-			configuration.collection.ManageRule = configuration.Rules.ManageRule
-			changed = true
-		}
+		updateRule(&configuration.collection.AuthRule, configuration.Rules.AuthRule, "auth_rule", &changed)
+		updateRule(&configuration.collection.ManageRule, configuration.Rules.ManageRule, "manage_rule", &changed)
 	}
 
-	if changed {
+	if len(changed) > 0 {
+		configuration.changes.record(ChangeUpdate, "rules", configuration.Name, "", strings.Join(changed, ", "))
 		_, err := configuration.saveAndRefreshCollection(app)
 		if err != nil {
-			log.Panicf("Failed to update collection rules for collection %s: %v", configuration.Name, err)
+			return fmt.Errorf("failed to save rules: %w", err)
 		}
 	}
+
+	return nil
+}
+
+// updateRule sets the collection rule to the configured value when they differ,
+// appending the rule name to changed. Rules are compared by value, as a nil rule
+// (superusers only) is distinct from an empty rule (public).
+func updateRule(current **string, configured *string, name string, changed *[]string) {
+	if (*current == nil) != (configured == nil) || (configured != nil && **current != *configured) {
+		*current = configured
+		*changed = append(*changed, name)
+	}
 }
 
-func (configuration *CollectionConfig) lockCollection(app *pocketbase.PocketBase) {
+func (configuration *CollectionConfig) lockCollection(app core.App) error {
 
-	if configuration.Editable {
-		return
+	if configuration.Editable || configuration.changes.isDryRun() {
+		return nil
 	}
 
 	override := superuser.CollectionOverrides{
@@ -325,56 +299,79 @@ func (configuration *CollectionConfig) lockCollection(app *pocketbase.PocketBase
 		PreventRecordDelete:     false,
 	}
 
-	override.ProcessCollectionOverride(app)
+	return override.ProcessCollectionOverride(app)
 
 }
 
-func (configuration *CollectionConfig) UpdateFields(app *pocketbase.PocketBase) {
+// fieldConfigs returns the configured fields, along with the created and
+// updated fields when AddDefaultFields is set.
+func (configuration *CollectionConfig) fieldConfigs(collection *core.Collection) []FieldConfig {
 
-	if configuration.Type == "view" {
-		return
-	}
-
-	collection, err := configuration.getCollection(app)
-	if err != nil {
-		log.Panicf("Failed to find collection: %v", err)
-	}
-	for _, fieldConfig := range configuration.Fields {
-		fieldConfig.CreateOrUpdate(app, collection)
-	}
+	fieldConfigs := configuration.Fields
 
 	if configuration.AddDefaultFields {
-		defaultFields := []FieldConfig{
-			{
+		fieldConfigs = append(fieldConfigs,
+			FieldConfig{
 				Id:       fmt.Sprintf("%s_autodate_created", collection.Name),
 				Name:     "created",
 				Type:     "autodate",
 				OnCreate: true,
 			},
-			{
+			FieldConfig{
 				Id:       fmt.Sprintf("%s_autodate_updated", collection.Name),
 				Name:     "updated",
 				Type:     "autodate",
 				OnUpdate: true,
 				OnCreate: true,
 			},
-		}
+		)
+	}
 
-		for _, fieldConfig := range defaultFields {
-			fieldConfig.CreateOrUpdate(app, collection)
-		}
+	return fieldConfigs
+}
+
+// UpdateFields creates or updates every configured field and removes fields
+// that are no longer configured. Every field that fails is reported, rather
+// than stopping at the first problem.
+func (configuration *CollectionConfig) UpdateFields(app core.App) error {
 
+	if configuration.Type == "view" {
+		return nil
+	}
+
+	collection, err := configuration.getCollection(app)
+	if err != nil {
+		return err
 	}
 
-	configuration.removeUnusedFields(app)
+	report := &ReconcileReport{}
+
+	for _, fieldConfig := range configuration.fieldConfigs(collection) {
+		err := fieldConfig.CreateOrUpdate(app, collection, configuration.changes)
+		if err != nil {
+			report.add(configuration.Name, fieldConfig.Name, "update field", err)
+
+			// Discard the failed change so it is not saved along with the next field.
+			collection, err = configuration.refreshCollection(app)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	report.add(configuration.Name, "", "remove fields", configuration.removeUnusedFields(app))
+
+	return report.err()
 }
 
-func (configuration *CollectionConfig) removeUnusedFields(app *pocketbase.PocketBase) {
+func (configuration *CollectionConfig) removeUnusedFields(app core.App) error {
 
-	configuration.refreshCollection(app)
+	if _, err := configuration.refreshCollection(app); err != nil {
+		return err
+	}
 
 	if configuration.RetainUnconfiguredFields {
-		return
+		return nil
 	}
 
 	var fields_to_retain []string
@@ -385,6 +382,11 @@ func (configuration *CollectionConfig) removeUnusedFields(app *pocketbase.Pocket
 		fields_to_retain = append(fields_to_retain, fieldConfig.Name)
 	}
 
+	keepPatterns, err := compileCollectionPatterns(configuration.KeepFields)
+	if err != nil {
+		return fmt.Errorf("invalid keep_fields: %w", err)
+	}
+
 	fields := configuration.collection.Fields
 
 	var default_fields []string
@@ -395,6 +397,8 @@ func (configuration *CollectionConfig) removeUnusedFields(app *pocketbase.Pocket
 		default_fields = []string{}
 	}
 
+	report := &ReconcileReport{}
+
 	for _, field := range fields {
 		found := false
 
@@ -427,73 +431,168 @@ func (configuration *CollectionConfig) removeUnusedFields(app *pocketbase.Pocket
 			continue
 		}
 
-		if !found {
-			log.Printf("Removing field %s from collection %s", field.GetName(), configuration.Name)
-			configuration.collection.Fields.RemoveById(field.GetId())
-			configuration.collection.Fields.RemoveByName(field.GetName())
-			configuration.saveAndRefreshCollection(app)
+		// Fields listed in keep_fields are never retired or deleted.
+		if matchCollectionPatterns(keepPatterns, configuration.prune.originalName(field.GetName())) {
+			continue
+		}
 
-			if configuration.collection.Fields.GetByName(field.GetName()) != nil {
-				log.Printf("Failed to remove field %s from collection %s. Possibly It Is Referred To Elsewhere (view)?", field.GetName(), configuration.Name)
+		// Retired fields are kept until their grace period is over.
+		if retiredAt, retired := configuration.prune.retiredAt(field.GetName()); retired {
+			if !configuration.prune.expired(retiredAt) {
+				continue
+			}
+			configuration.changes.record(ChangeDelete, "field", configuration.Name, field.GetName(), "retired, grace period over")
+		} else if configuration.pruneMode() == PruneModeRetire {
+			retiredName := configuration.prune.retiredName(field.GetName())
+			configuration.changes.record(ChangeUpdate, "field", configuration.Name, field.GetName(), "not in config, retired as "+retiredName)
+			current := configuration.collection.Fields.GetById(field.GetId())
+			if current == nil {
+				continue
+			}
+			if err := retireField(configuration.collection, current, configuration.prune, configuration.changes); err != nil {
+				report.add(configuration.Name, field.GetName(), "retire field", err)
+				continue
+			}
+			if _, err := configuration.saveAndRefreshCollection(app); err != nil {
+				report.add(configuration.Name, field.GetName(), "retire field", err)
 			}
+			continue
+		} else {
+			configuration.changes.record(ChangeDelete, "field", configuration.Name, field.GetName(), "not in config")
+		}
 
+		removeFieldIndexes(configuration.collection, field.GetName(), configuration.changes)
+		configuration.collection.Fields.RemoveById(field.GetId())
+		configuration.collection.Fields.RemoveByName(field.GetName())
+		if _, err := configuration.saveAndRefreshCollection(app); err != nil {
+			report.add(configuration.Name, field.GetName(), "remove field", fmt.Errorf("possibly it is referred to elsewhere (view): %w", err))
 		}
 	}
+
+	return report.err()
+}
+
+// pruneMode returns the prune mode for the fields of this collection, which
+// defaults to the prune mode of the collections configuration.
+func (configuration *CollectionConfig) pruneMode() string {
+	if configuration.PruneMode != "" {
+		return configuration.PruneMode
+	}
+	if configuration.prune != nil {
+		return configuration.prune.Mode
+	}
+	return PruneModeDelete
 }
 
-func (configuration *CollectionConfig) RemoveCollection(app *pocketbase.PocketBase) {
+func (configuration *CollectionConfig) RemoveCollection(app core.App) error {
 
 	_, err := configuration.refreshCollection(app)
 	if err != nil {
-		log.Println("Failed to find collection", err)
-		return
+		// Nothing to remove.
+		return nil
 	}
 
-	app.Delete(configuration.collection)
+	configuration.changes.record(ChangeDelete, "collection", configuration.collection.Name, "", "")
+	if err := app.Delete(configuration.collection); err != nil {
+		return err
+	}
 
 	configuration.collection = nil
 
+	return nil
 }
 
-func (configuration *CollectionConfig) RemoveIndexes(app *pocketbase.PocketBase) {
+// RemoveIndexes removes the indexes that are no longer configured or whose
+// definition has changed. Unchanged indexes are kept, so they are not rebuilt
+// on every start.
+func (configuration *CollectionConfig) RemoveIndexes(app core.App) error {
 
 	_, err := configuration.refreshCollection(app)
 	if err != nil {
-		return
+		// The collection does not exist yet, so it has no indexes.
+		return nil
+	}
+
+	tableIndexes, err := app.TableIndexes(configuration.collection.Name)
+	if err != nil {
+		return fmt.Errorf("failed to read indexes: %w", err)
+	}
+
+	configured := map[string]dbutils.Index{}
+	for _, indexConfig := range configuration.Indexes {
+		configured[strings.ToLower(indexConfig.Id)] = indexConfig.definition()
 	}
 
-	tableIndexes, _ := app.TableIndexes(configuration.collection.Name)
+	indexNames := make([]string, 0, len(tableIndexes))
+	for indexName := range tableIndexes {
+		indexNames = append(indexNames, indexName)
+	}
+	sort.Strings(indexNames)
+
+	removed := false
+	for _, indexName := range indexNames {
+		existing := dbutils.ParseIndex(tableIndexes[indexName])
+
+		configuredIndex, found := configured[strings.ToLower(indexName)]
+		if found && indexesEqual(existing, configuredIndex) {
+			continue
+		}
+
+		if isSystemIndex(configuration.collection, existing) {
+			continue
+		}
+
+		detail := "not in config"
+		if found {
+			detail = "definition changed"
+		}
 
-	for index_id := range tableIndexes {
-		configuration.collection.RemoveIndex(index_id)
+		configuration.changes.record(ChangeDelete, "index", configuration.collection.Name, indexName, detail)
+		configuration.collection.RemoveIndex(indexName)
+		removed = true
 	}
 
-	configuration.saveAndRefreshCollection(app)
+	if !removed {
+		return nil
+	}
 
+	_, err = configuration.saveAndRefreshCollection(app)
+	return err
 }
 
-func (configuration *CollectionConfig) updateIndexes(app *pocketbase.PocketBase) {
+// updateIndexes creates the configured indexes that do not exist yet. Changed
+// indexes have already been removed by RemoveIndexes.
+func (configuration *CollectionConfig) updateIndexes(app core.App) error {
 
 	_, err := configuration.refreshCollection(app)
 	if err != nil {
-		log.Panicf("Failed to find collection: %v", err)
+		return err
 	}
 
-	// If there are no indexes in the configuration, make no updates
-	if len(configuration.Indexes) == 0 {
-		return
-	}
+	added := false
+	for _, indexConfig := range configuration.Indexes {
+		index_details, err := indexConfig.getIndexQuery(configuration.collection)
+		if err != nil {
+			return err
+		}
 
-	configuration.RemoveIndexes(app)
+		if configuration.collection.GetIndex(index_details.Name) != "" {
+			continue
+		}
 
-	for _, indexConfig := range configuration.Indexes {
-		index_details := indexConfig.getIndexQuery(configuration.collection)
-		configuration.collection.AddIndex(index_details.Name, index_details.Unique, index_details.ColumnExpr, "")
+		configuration.changes.record(ChangeCreate, "index", configuration.Name, index_details.Name, index_details.ColumnExpr)
+		configuration.collection.AddIndex(index_details.Name, index_details.Unique, index_details.ColumnExpr, index_details.Where)
+		added = true
+	}
+
+	if !added {
+		return nil
 	}
 
 	_, err = configuration.saveAndRefreshCollection(app)
 	if err != nil {
-		log.Panicf("Failed to update collection indexes for collection %s: %v", configuration.Name, err)
+		return fmt.Errorf("failed to save indexes: %w", err)
 	}
 
+	return nil
 }
@@ -0,0 +1,174 @@
+package collections
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// viewTablePattern matches the table names following FROM and JOIN in a view query.
+var viewTablePattern = regexp.MustCompile("(?i)\\b(?:from|join)\\s+[`\"\\[]?(\\w+)")
+
+// viewDependencies returns the lower case names of the tables a view query selects from.
+func viewDependencies(query string) []string {
+	var dependencies []string
+	seen := map[string]bool{}
+
+	for _, match := range viewTablePattern.FindAllStringSubmatch(query, -1) {
+		name := strings.ToLower(match[1])
+		if !seen[name] {
+			seen[name] = true
+			dependencies = append(dependencies, name)
+		}
+	}
+
+	return dependencies
+}
+
+// orderViews returns the configured views ordered so that every view comes
+// after the views it selects from.
+func orderViews(collectionConfigs []CollectionConfig) ([]*CollectionConfig, error) {
+
+	views := map[string]*CollectionConfig{}
+	var names []string
+	for i := range collectionConfigs {
+		if collectionConfigs[i].Type == "view" {
+			name := strings.ToLower(collectionConfigs[i].Name)
+			views[name] = &collectionConfigs[i]
+			names = append(names, name)
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	ordered := make([]*CollectionConfig, 0, len(names))
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("view collections depend on each other: %s", strings.Join(append(path, name), " -> "))
+		}
+
+		state[name] = visiting
+		for _, dependency := range viewDependencies(views[name].ViewQuery) {
+			if _, isView := views[dependency]; isView {
+				if err := visit(dependency, append(path, name)); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = visited
+
+		ordered = append(ordered, views[name])
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// removeChangedViews removes the configured views whose query has changed, or
+// that select (directly or through other views) from a collection whose fields
+// are being removed, renamed or changed. These views are recreated once the
+// fields have been updated, and all other views are left in place.
+func removeChangedViews(app core.App, collectionConfigs []CollectionConfig, views []*CollectionConfig) error {
+
+	changed := map[string]bool{}
+	for i := range collectionConfigs {
+		collectionConfig := &collectionConfigs[i]
+		if collectionConfig.Type != "view" && collectionConfig.changesExistingFields(app) {
+			changed[strings.ToLower(collectionConfig.Name)] = true
+		}
+	}
+
+	// Views are in dependency order, so the views a view selects from have
+	// already been checked.
+	var removals []*CollectionConfig
+	for _, view := range views {
+		name := strings.ToLower(view.Name)
+		changed[name] = view.viewChanged(app)
+		for _, dependency := range viewDependencies(view.ViewQuery) {
+			if changed[dependency] {
+				changed[name] = true
+			}
+		}
+
+		if changed[name] {
+			removals = append(removals, view)
+		}
+	}
+
+	report := &ReconcileReport{}
+
+	// Remove dependent views before the views they select from.
+	for i := len(removals) - 1; i >= 0; i-- {
+		report.add(removals[i].Name, "", "remove view", removals[i].RemoveCollection(app))
+	}
+
+	return report.err()
+}
+
+// viewChanged reports whether the existing view collection has a different
+// query (or type) than the configuration.
+func (configuration *CollectionConfig) viewChanged(app core.App) bool {
+	collection, err := configuration.refreshCollection(app)
+	if err != nil {
+		return false
+	}
+
+	return collection.Type != core.CollectionTypeView || normalizeSQL(collection.ViewQuery) != normalizeSQL(configuration.ViewQuery)
+}
+
+// changesExistingFields reports whether updating the fields will remove, rename
+// or change the type of an existing field, or rename the collection itself.
+func (configuration *CollectionConfig) changesExistingFields(app core.App) bool {
+	collection, err := configuration.refreshCollection(app)
+	if err != nil {
+		return false
+	}
+
+	if collection.Name != configuration.Name {
+		return true
+	}
+
+	configuredTypes := map[string]string{}
+	renamed := map[string]bool{}
+	for _, fieldConfig := range configuration.fieldConfigs(collection) {
+		configuredTypes[fieldConfig.Name] = fieldConfig.Type
+		if fieldConfig.RenamedFrom != "" {
+			renamed[fieldConfig.RenamedFrom] = true
+		}
+	}
+
+	for _, field := range collection.Fields {
+		if field.GetSystem() {
+			continue
+		}
+
+		configuredType, configured := configuredTypes[field.GetName()]
+		if configured && configuredType == field.Type() {
+			continue
+		}
+
+		if !configured && configuration.RetainUnconfiguredFields && !renamed[field.GetName()] && !renamed[field.GetId()] {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
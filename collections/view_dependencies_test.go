@@ -0,0 +1,102 @@
+package collections
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestViewDependencies(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "SELECT id FROM posts", want: []string{"posts"}},
+		{query: "select id from `Posts`", want: []string{"posts"}},
+		{query: `SELECT p.id FROM "posts" p JOIN [users] u ON u.id = p.author`, want: []string{"posts", "users"}},
+		{query: "SELECT id FROM posts LEFT JOIN comments ON comments.post = posts.id JOIN posts p2", want: []string{"posts", "comments"}},
+		{query: "SELECT id FROM (SELECT id FROM drafts)", want: []string{"drafts"}},
+		{query: "SELECT id, fromage FROM cheeses", want: []string{"cheeses"}},
+		{query: "SELECT 1 AS id", want: nil},
+	}
+
+	for _, test := range tests {
+		if got := viewDependencies(test.query); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("viewDependencies(%q) = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestOrderViews(t *testing.T) {
+	tests := []struct {
+		name        string
+		collections []CollectionConfig
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name: "no views",
+			collections: []CollectionConfig{
+				{Name: "posts", Type: "base"},
+			},
+			want: []string{},
+		},
+		{
+			name: "configuration order when independent",
+			collections: []CollectionConfig{
+				{Name: "a", Type: "view", ViewQuery: "SELECT id FROM posts"},
+				{Name: "posts", Type: "base"},
+				{Name: "b", Type: "view", ViewQuery: "SELECT id FROM posts"},
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "dependencies first",
+			collections: []CollectionConfig{
+				{Name: "top", Type: "view", ViewQuery: "SELECT id FROM middle JOIN Bottom ON 1=1"},
+				{Name: "middle", Type: "view", ViewQuery: "SELECT id FROM bottom"},
+				{Name: "Bottom", Type: "view", ViewQuery: "SELECT id FROM posts"},
+			},
+			want: []string{"Bottom", "middle", "top"},
+		},
+		{
+			name: "cycle",
+			collections: []CollectionConfig{
+				{Name: "a", Type: "view", ViewQuery: "SELECT id FROM b"},
+				{Name: "b", Type: "view", ViewQuery: "SELECT id FROM a"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "self reference",
+			collections: []CollectionConfig{
+				{Name: "a", Type: "view", ViewQuery: "SELECT id FROM a"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		ordered, err := orderViews(test.collections)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			} else if !strings.Contains(err.Error(), "->") {
+				t.Errorf("%s: expected the error to show the cycle, got %v", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+
+		names := make([]string, 0, len(ordered))
+		for _, view := range ordered {
+			names = append(names, view.Name)
+		}
+		if !reflect.DeepEqual(names, test.want) {
+			t.Errorf("%s: orderViews() = %v, want %v", test.name, names, test.want)
+		}
+	}
+}
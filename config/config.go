@@ -1,28 +1,81 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/spf13/viper"
 )
 
-func LoadConfig() (*viper.Viper, error) {
+// configDir is the directory of the first configuration file, which relative
+// paths in the configuration are resolved against. It is set with SetConfigDir
+// when the server starts, and does not change when the configuration is
+// reloaded.
+var configDir = "."
+
+// Sources are the files a configuration was loaded from.
+type Sources struct {
+	// Files are the configuration files that were loaded, in order.
+	Files []string
+
+	// Dir is the directory of the first configuration file.
+	Dir string
+
+	// References are the files read with file: references.
+	References []string
+}
+
+// ConfigDirectory returns the config.d directory whose files are merged into
+// the configuration.
+func (sources Sources) ConfigDirectory() string {
+	return filepath.Join(sources.Dir, configDirectoryName)
+}
+
+// configDirectoryName is the directory, next to the first configuration file,
+// whose files are merged into the configuration.
+const configDirectoryName = "config.d"
+
+// configExtensions are the configuration file types that are loaded from the
+// config.d directory.
+var configExtensions = []string{".toml", ".yaml", ".yml", ".json"}
+
+// LoadConfig loads the configuration, and returns it along with the files it
+// was loaded from.
+func LoadConfig(options Options) (*viper.Viper, Sources, error) {
 	v := viper.New()
-	v.SetConfigName("config") // name of config file (without extension)
-	v.AddConfigPath(".")      // optionally look for config in the working directory
-	v.AutomaticEnv()          // read in environment variables that match
-
-	// Check for config file in multiple formats
-	configFiles := []string{"config.toml", "config.yaml", "config.json"}
-	for _, configFile := range configFiles {
-		v.SetConfigFile(configFile)
-		if err := v.ReadInConfig(); err == nil {
-			break
+
+	sources, err := configFiles(options)
+	if err != nil {
+		return nil, sources, err
+	}
+
+	// Each file is deep-merged over the previous files.
+	for i, file := range sources.Files {
+		v.SetConfigFile(file)
+		if i == 0 {
+			err = v.ReadInConfig()
+		} else {
+			err = v.MergeInConfig()
+		}
+		if err != nil {
+			return nil, sources, fmt.Errorf("failed to read configuration file %s: %w", file, err)
 		}
 	}
 
+	if err := applyProfile(v, options.Profile); err != nil {
+		return nil, sources, err
+	}
+
+	// Once the selected profile is merged, the profiles are left out, so that
+	// the other profiles are not resolved or validated.
+	v, err = withoutProfiles(v)
+	if err != nil {
+		return nil, sources, err
+	}
+
 	// Set default values
 	v.SetDefault("settings.hooks_dir", defaultHooksDir())
 	v.SetDefault("settings.hooks_watch", true)
@@ -32,7 +85,125 @@ func LoadConfig() (*viper.Viper, error) {
 	v.SetDefault("settings.public_dir", defaultPublicDir())
 	v.SetDefault("settings.index_fallback", true)
 
-	return v, nil
+	// Environment variables override the configuration files.
+	if err := applyEnvironment(v, os.Environ(), options.ValueType); err != nil {
+		return nil, sources, fmt.Errorf("failed to read configuration from the environment: %w", err)
+	}
+
+	// Resolve environment and file references before the configuration is validated.
+	sources.References = fileReferences(v.AllSettings(), sources.Dir)
+	if err := resolveReferences(v, sources.Dir); err != nil {
+		return nil, sources, fmt.Errorf("failed to resolve configuration references: %w", err)
+	}
+
+	return v, sources, nil
+}
+
+// SetConfigDir sets the directory relative paths in the configuration are
+// resolved against. It is called once, before the configuration is applied.
+func SetConfigDir(dir string) {
+	configDir = dir
+}
+
+// IsConfigFile reports whether the path has the extension of a configuration file.
+func IsConfigFile(path string) bool {
+	return slices.Contains(configExtensions, strings.ToLower(filepath.Ext(path)))
+}
+
+// applyProfile deep-merges the profile from the profiles section over the
+// configuration.
+func applyProfile(v *viper.Viper, profile string) error {
+	if profile == "" {
+		return nil
+	}
+
+	// Configuration keys are lowercased when they are read.
+	profiles := v.GetStringMap("profiles")
+	settings, ok := profiles[strings.ToLower(profile)]
+	if !ok {
+		return fmt.Errorf("configuration profile %s is not defined", profile)
+	}
+
+	profileConfig, ok := settings.(map[string]any)
+	if !ok {
+		return fmt.Errorf("configuration profile %s is not a map of settings", profile)
+	}
+
+	return v.MergeConfigMap(profileConfig)
+}
+
+// withoutProfiles returns a copy of the configuration without the profiles
+// section, as viper cannot remove a key.
+func withoutProfiles(v *viper.Viper) (*viper.Viper, error) {
+	settings := v.AllSettings()
+	if _, ok := settings["profiles"]; !ok {
+		return v, nil
+	}
+	delete(settings, "profiles")
+
+	stripped := viper.New()
+	if err := stripped.MergeConfigMap(settings); err != nil {
+		return nil, fmt.Errorf("failed to read the configuration: %w", err)
+	}
+	return stripped, nil
+}
+
+// configFiles returns the configuration files to load, in order: the first
+// configuration file, the files in the config.d directory next to it (sorted by
+// name), and then the other files given with --config. Without --config, the
+// first of config.toml, config.yaml and config.json in the working directory is
+// used.
+func configFiles(options Options) (Sources, error) {
+	var first string
+	var rest []string
+
+	if len(options.ConfigFiles) > 0 {
+		for _, file := range options.ConfigFiles {
+			if _, err := os.Stat(file); err != nil {
+				return Sources{}, fmt.Errorf("configuration file %s not found", file)
+			}
+		}
+		first, rest = options.ConfigFiles[0], options.ConfigFiles[1:]
+	} else {
+		for _, file := range []string{"config.toml", "config.yaml", "config.json"} {
+			if _, err := os.Stat(file); err == nil {
+				first = file
+				break
+			}
+		}
+	}
+
+	sources := Sources{Dir: "."}
+	if first != "" {
+		sources.Dir = filepath.Dir(first)
+		sources.Files = append(sources.Files, first)
+	}
+
+	entries, err := os.ReadDir(sources.ConfigDirectory())
+	if err != nil && !os.IsNotExist(err) {
+		return sources, fmt.Errorf("failed to read %s: %w", configDirectoryName, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && IsConfigFile(entry.Name()) {
+			sources.Files = append(sources.Files, filepath.Join(sources.ConfigDirectory(), entry.Name()))
+		}
+	}
+
+	sources.Files = append(sources.Files, rest...)
+	return sources, nil
+}
+
+// ResolvePath returns the path relative to the directory of the first
+// configuration file, unless it is absolute.
+func ResolvePath(path string) string {
+	return resolvePath(configDir, path)
+}
+
+func resolvePath(dir string, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
 }
 
 // the default pb_public dir location is relative to the executable
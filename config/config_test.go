@@ -0,0 +1,142 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfigMergeOrder(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "config.yaml")
+	extra := filepath.Join(t.TempDir(), "extra.json")
+
+	writeConfigFile(t, first, `
+settings:
+  app_name: first
+  sender: first
+  limit: 1
+collections:
+  - name: posts
+`)
+	// config.d files are merged in name order, whatever their type.
+	writeConfigFile(t, filepath.Join(dir, "config.d", "20-second.toml"), `
+[settings]
+sender = "second"
+limit = 2
+`)
+	writeConfigFile(t, filepath.Join(dir, "config.d", "10-first.yml"), `
+settings:
+  sender: ten
+  limit: 10
+collections:
+  - name: comments
+`)
+	writeConfigFile(t, filepath.Join(dir, "config.d", "30-notes.txt"), "not: loaded")
+	writeConfigFile(t, filepath.Join(dir, "config.d", "40-dir.yaml", "nested.yaml"), "not: loaded")
+	writeConfigFile(t, extra, `{"settings": {"limit": 3}}`)
+
+	v, sources, err := LoadConfig(Options{ConfigFiles: []string{first, extra}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFiles := []string{
+		first,
+		filepath.Join(dir, "config.d", "10-first.yml"),
+		filepath.Join(dir, "config.d", "20-second.toml"),
+		extra,
+	}
+	if !reflect.DeepEqual(sources.Files, wantFiles) {
+		t.Errorf("sources.Files = %v, want %v", sources.Files, wantFiles)
+	}
+	if sources.Dir != dir {
+		t.Errorf("sources.Dir = %s, want %s", sources.Dir, dir)
+	}
+
+	// Later files override the values of earlier files, and other values are kept.
+	if got := v.GetString("settings.app_name"); got != "first" {
+		t.Errorf("settings.app_name = %s, want first", got)
+	}
+	if got := v.GetString("settings.sender"); got != "second" {
+		t.Errorf("settings.sender = %s, want second", got)
+	}
+	if got := v.GetInt("settings.limit"); got != 3 {
+		t.Errorf("settings.limit = %d, want 3", got)
+	}
+	if v.IsSet("not") {
+		t.Error("a file that is not a configuration file was loaded")
+	}
+
+	// Lists are replaced rather than merged.
+	collections, ok := v.Get("collections").([]any)
+	if !ok || len(collections) != 1 {
+		t.Fatalf("collections = %#v, want one collection", v.Get("collections"))
+	}
+	if name := collections[0].(map[string]any)["name"]; name != "comments" {
+		t.Errorf("collection name = %v, want comments", name)
+	}
+}
+
+func TestLoadConfigProfiles(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, file, `
+settings:
+  app_name: base
+  sender: base
+profiles:
+  dev:
+    settings:
+      app_name: dev
+  prod:
+    settings:
+      app_name: ${TEST_PROFILE_UNSET_VARIABLE}
+      sender: env:TEST_PROFILE_UNSET_VARIABLE
+`)
+
+	tests := []struct {
+		profile     string
+		wantAppName string
+		wantErr     bool
+	}{
+		{profile: "", wantAppName: "base"},
+		{profile: "dev", wantAppName: "dev"},
+		{profile: "DEV", wantAppName: "dev"},
+		{profile: "prod", wantErr: true},
+		{profile: "missing", wantErr: true},
+	}
+
+	for _, test := range tests {
+		v, _, err := LoadConfig(Options{ConfigFiles: []string{file}, Profile: test.profile})
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("profile %q: LoadConfig() did not return an error", test.profile)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("profile %q: LoadConfig() returned error %v", test.profile, err)
+			continue
+		}
+		if got := v.GetString("settings.app_name"); got != test.wantAppName {
+			t.Errorf("profile %q: settings.app_name = %s, want %s", test.profile, got, test.wantAppName)
+		}
+		if got := v.GetString("settings.sender"); got != "base" {
+			t.Errorf("profile %q: settings.sender = %s, want base", test.profile, got)
+		}
+		if v.IsSet("profiles") {
+			t.Errorf("profile %q: the profiles are still in the configuration", test.profile)
+		}
+	}
+}
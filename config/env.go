@@ -0,0 +1,256 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables that override
+// configuration values. Nested keys and list indexes are separated with a
+// double underscore, so POCKETFORGE_SUPERUSER__ACCOUNTS__0__EMAIL sets the
+// email of the first superuser account.
+const EnvPrefix = "POCKETFORGE_"
+
+// ProfileEnv is the environment variable selecting the configuration profile.
+// It is not mapped to a configuration key.
+const ProfileEnv = EnvPrefix + "PROFILE"
+
+// envKeySeparator separates the nested keys in environment variable names.
+const envKeySeparator = "__"
+
+// applyEnvironment sets the configuration values given in environment
+// variables, over the values from the configuration files. Each value is parsed
+// as the type of the value it replaces, or the type from valueType (which may
+// be nil) for keys that are not set.
+func applyEnvironment(v *viper.Viper, environ []string, valueType func(path []string) string) error {
+
+	// Sorted, so that a list item is created before a later index is set.
+	sort.Slice(environ, func(i, j int) bool {
+		return envNameLess(environ[i], environ[j])
+	})
+
+	settings := v.AllSettings()
+	changed := map[string]bool{}
+
+	for _, entry := range environ {
+		name, value, _ := strings.Cut(entry, "=")
+		keyName, ok := strings.CutPrefix(name, EnvPrefix)
+		if !ok || keyName == "" || name == ProfileEnv {
+			continue
+		}
+
+		path := strings.Split(strings.ToLower(keyName), envKeySeparator)
+
+		kind := envValueType(settings[path[0]], path[1:])
+		if kind == "" && valueType != nil {
+			kind = valueType(path)
+		}
+
+		parsed, err := parseEnvValue(value, kind)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		updated, err := setPath(settings[path[0]], path[1:], parsed)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		settings[path[0]] = updated
+		changed[path[0]] = true
+	}
+
+	for key := range changed {
+		v.Set(key, settings[key])
+	}
+
+	return nil
+}
+
+// envNameLess orders environment variables by their key path, comparing list
+// indexes as numbers.
+func envNameLess(a string, b string) bool {
+	nameA, _, _ := strings.Cut(a, "=")
+	nameB, _, _ := strings.Cut(b, "=")
+	pathA := strings.Split(nameA, envKeySeparator)
+	pathB := strings.Split(nameB, envKeySeparator)
+
+	for i := 0; i < len(pathA) && i < len(pathB); i++ {
+		if pathA[i] == pathB[i] {
+			continue
+		}
+		indexA, errA := strconv.Atoi(pathA[i])
+		indexB, errB := strconv.Atoi(pathB[i])
+		if errA == nil && errB == nil {
+			return indexA < indexB
+		}
+		return pathA[i] < pathB[i]
+	}
+
+	return len(pathA) < len(pathB)
+}
+
+// envValueType returns the schema type ("boolean", "integer", "number",
+// "array", "object" or "string") of the value at the path within current, or
+// "" if there is no value.
+func envValueType(current any, path []string) string {
+	for _, key := range path {
+		switch typed := current.(type) {
+		case map[string]any:
+			current = typed[key]
+		case []map[string]any:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(typed) {
+				return ""
+			}
+			current = typed[index]
+		case []any:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(typed) {
+				return ""
+			}
+			current = typed[index]
+		default:
+			return ""
+		}
+	}
+
+	switch current.(type) {
+	case nil:
+		return ""
+	case bool:
+		return "boolean"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "integer"
+	case float32, float64:
+		return "number"
+	case []any, []string, []map[string]any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return "string"
+	}
+}
+
+// parseEnvValue returns the value of an environment variable as the given
+// schema type, so that it has the same type as in a configuration file. Values
+// of any other type (or of unknown type) are kept as text exactly as given, so
+// secrets and values such as 00123 are never changed.
+func parseEnvValue(value string, kind string) (any, error) {
+	switch kind {
+	case "boolean":
+		if value != "true" && value != "false" {
+			return nil, fmt.Errorf("%s is not true or false", value)
+		}
+		return value == "true", nil
+	case "integer":
+		number, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s is not an integer", value)
+		}
+		return number, nil
+	case "number":
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a number", value)
+		}
+		return number, nil
+	case "array":
+		return parseEnvList(value)
+	default:
+		return value, nil
+	}
+}
+
+// parseEnvList parses a YAML flow list of values (such as [a, b]). The items
+// are kept as text. Items that YAML would change (comments, tags and aliases)
+// or nested lists and maps are an error rather than silently changed.
+func parseEnvList(value string) ([]any, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &document); err != nil {
+		return nil, fmt.Errorf("invalid list: %w", err)
+	}
+
+	if len(document.Content) != 1 || document.Content[0].Kind != yaml.SequenceNode || hasComments(&document) {
+		return nil, fmt.Errorf("invalid list %s, quote the items containing special characters", value)
+	}
+
+	sequence := document.Content[0]
+	if sequence.Tag != "!!seq" || sequence.Anchor != "" || sequence.Style&yaml.TaggedStyle != 0 || hasComments(sequence) {
+		return nil, fmt.Errorf("invalid list %s, quote the items containing special characters", value)
+	}
+
+	items := make([]any, 0, len(sequence.Content))
+	for _, node := range sequence.Content {
+		if node.Kind != yaml.ScalarNode || node.Anchor != "" || node.Style&yaml.TaggedStyle != 0 || hasComments(node) {
+			return nil, fmt.Errorf("invalid list item in %s, quote the items containing special characters", value)
+		}
+
+		items = append(items, node.Value)
+	}
+
+	return items, nil
+}
+
+func hasComments(node *yaml.Node) bool {
+	return node.HeadComment != "" || node.LineComment != "" || node.FootComment != ""
+}
+
+// setPath sets the value at the path within current, which is a map, a list or
+// nil, and returns the updated value. Numeric path segments are list indexes.
+func setPath(current any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	key := path[0]
+
+	if index, err := strconv.Atoi(key); err == nil {
+		// Lists of tables can be read as lists of maps.
+		if maps, ok := current.([]map[string]any); ok {
+			converted := make([]any, len(maps))
+			for i, item := range maps {
+				converted[i] = item
+			}
+			current = converted
+		}
+
+		list, ok := current.([]any)
+		if current != nil && !ok {
+			return nil, fmt.Errorf("%s is a list index, but the value is not a list", key)
+		}
+		if index < 0 || index > len(list) {
+			return nil, fmt.Errorf("list index %d is out of range (the list has %d items)", index, len(list))
+		}
+		if index == len(list) {
+			list = append(list, nil)
+		}
+
+		item, err := setPath(list[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		list[index] = item
+		return list, nil
+	}
+
+	items, ok := current.(map[string]any)
+	if current != nil && !ok {
+		return nil, fmt.Errorf("%s is a key, but the value is not a map", key)
+	}
+	if items == nil {
+		items = map[string]any{}
+	}
+
+	item, err := setPath(items[key], path[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	items[key] = item
+	return items, nil
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseEnvValue(t *testing.T) {
+	tests := []struct {
+		value   string
+		kind    string
+		want    any
+		wantErr bool
+	}{
+		{value: "", want: ""},
+		{value: "true", want: "true"},
+		{value: "12345678", want: "12345678"},
+		{value: "1.50", want: "1.50"},
+		{value: "[a, b]", want: "[a, b]"},
+		{value: "12345678", kind: "string", want: "12345678"},
+		{value: "true", kind: "boolean", want: true},
+		{value: "false", kind: "boolean", want: false},
+		{value: "True", kind: "boolean", wantErr: true},
+		{value: "yes", kind: "boolean", wantErr: true},
+		{value: "15", kind: "integer", want: 15},
+		{value: "-3", kind: "integer", want: -3},
+		{value: "007", kind: "integer", want: 7},
+		{value: "1.5", kind: "integer", wantErr: true},
+		{value: "abc", kind: "integer", wantErr: true},
+		{value: "1.50", kind: "number", want: 1.5},
+		{value: "15", kind: "number", want: 15.0},
+		{value: "abc", kind: "number", wantErr: true},
+		{value: "a: b", kind: "object", want: "a: b"},
+		{value: "[]", kind: "array", want: []any{}},
+		{value: "[a, b]", kind: "array", want: []any{"a", "b"}},
+		{value: "[1, true, 007]", kind: "array", want: []any{"1", "true", "007"}},
+		{value: `["a, b", 'c']`, kind: "array", want: []any{"a, b", "c"}},
+		{value: "a, b", kind: "array", wantErr: true},
+		{value: "[a", kind: "array", wantErr: true},
+		{value: "[a #b]", kind: "array", wantErr: true},
+		{value: "[a, # b\n c]", kind: "array", wantErr: true},
+		{value: "[a] #b", kind: "array", wantErr: true},
+		{value: "[!secret]", kind: "array", wantErr: true},
+		{value: "[*abc]", kind: "array", wantErr: true},
+		{value: "[&a b]", kind: "array", wantErr: true},
+		{value: "[@foo]", kind: "array", wantErr: true},
+		{value: "[[a]]", kind: "array", wantErr: true},
+		{value: "[a: b]", kind: "array", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseEnvValue(test.value, test.kind)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseEnvValue(%q, %q) = %#v, want an error", test.value, test.kind, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseEnvValue(%q, %q) returned error %v", test.value, test.kind, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseEnvValue(%q, %q) = %#v, want %#v", test.value, test.kind, got, test.want)
+		}
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		current any
+		path    []string
+		want    any
+		wantErr bool
+	}{
+		{name: "value", current: "old", path: nil, want: "new"},
+		{name: "new key", current: nil, path: []string{"a", "b"}, want: map[string]any{"a": map[string]any{"b": "new"}}},
+		{name: "existing key", current: map[string]any{"a": "old", "b": "kept"}, path: []string{"a"}, want: map[string]any{"a": "new", "b": "kept"}},
+		{name: "list item", current: []any{"a", "b"}, path: []string{"1"}, want: []any{"a", "new"}},
+		{name: "appended item", current: []any{"a"}, path: []string{"1"}, want: []any{"a", "new"}},
+		{name: "first item", current: nil, path: []string{"0", "name"}, want: []any{map[string]any{"name": "new"}}},
+		{name: "list of maps", current: []map[string]any{{"name": "old", "id": "x"}}, path: []string{"0", "name"}, want: []any{map[string]any{"name": "new", "id": "x"}}},
+		{name: "index out of range", current: []any{"a"}, path: []string{"2"}, wantErr: true},
+		{name: "index into a map", current: map[string]any{}, path: []string{"0"}, wantErr: true},
+		{name: "key into a list", current: []any{"a"}, path: []string{"a"}, wantErr: true},
+		{name: "key into a value", current: "text", path: []string{"a"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := setPath(test.current, test.path, "new")
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: setPath() = %#v, want an error", test.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: setPath() returned error %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: setPath() = %#v, want %#v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestApplyEnvironment(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.Set("settings", map[string]any{"app_name": "from file", "hooks_pool": 15, "ratio": 0.5, "watch": true})
+	v.Set("superuser", map[string]any{"accounts": []any{map[string]any{"email": "first@example.com", "password": "file password"}}})
+	v.Set("collections", map[string]any{"retain_collections": []any{"users"}})
+	v.SetDefault("validation.enabled", false)
+
+	schemaTypes := map[string]string{"data.enabled": "boolean"}
+	valueType := func(path []string) string {
+		key := path[0]
+		for _, item := range path[1:] {
+			key += "." + item
+		}
+		return schemaTypes[key]
+	}
+
+	err := applyEnvironment(v, []string{
+		"POCKETFORGE_SETTINGS__APP_NAME=from env",
+		"POCKETFORGE_SETTINGS__HOOKS_POOL=20",
+		"POCKETFORGE_SETTINGS__RATIO=1.50",
+		"POCKETFORGE_SETTINGS__WATCH=false",
+		"POCKETFORGE_SETTINGS__NEW_KEY=12345678",
+		"POCKETFORGE_SUPERUSER__ACCOUNTS__0__PASSWORD=12345678",
+		"POCKETFORGE_SUPERUSER__ACCOUNTS__1__EMAIL=second@example.com",
+		"POCKETFORGE_COLLECTIONS__RETAIN_COLLECTIONS=[users, posts]",
+		"POCKETFORGE_VALIDATION__ENABLED=true",
+		"POCKETFORGE_DATA__ENABLED=true",
+		"POCKETFORGE_PROFILE=dev",
+		"OTHER_VARIABLE=ignored",
+	}, valueType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key  string
+		want any
+	}{
+		{key: "settings.app_name", want: "from env"},
+		{key: "settings.hooks_pool", want: 20},
+		{key: "settings.ratio", want: 1.5},
+		{key: "settings.watch", want: false},
+		{key: "settings.new_key", want: "12345678"},
+		{key: "superuser.accounts", want: []any{
+			map[string]any{"email": "first@example.com", "password": "12345678"},
+			map[string]any{"email": "second@example.com"},
+		}},
+		{key: "collections.retain_collections", want: []any{"users", "posts"}},
+		{key: "validation.enabled", want: true},
+		{key: "data.enabled", want: true},
+		{key: "profile", want: nil},
+	}
+
+	for _, test := range tests {
+		if got := v.Get(test.key); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s = %#v, want %#v", test.key, got, test.want)
+		}
+	}
+}
+
+func TestApplyEnvironmentErrors(t *testing.T) {
+	tests := []string{
+		"POCKETFORGE_SETTINGS__WATCH=yes",
+		"POCKETFORGE_SETTINGS__HOOKS_POOL=many",
+		"POCKETFORGE_SUPERUSER__ACCOUNTS__5__EMAIL=admin@example.com",
+	}
+
+	for _, entry := range tests {
+		v := viper.New()
+		v.Set("settings", map[string]any{"watch": true, "hooks_pool": 15})
+		v.Set("superuser", map[string]any{"accounts": []any{}})
+
+		if err := applyEnvironment(v, []string{entry}, nil); err == nil {
+			t.Errorf("applyEnvironment(%s) did not return an error", entry)
+		}
+	}
+}
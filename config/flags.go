@@ -0,0 +1,50 @@
+package config
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Options are the command line flags that control how the configuration is
+// loaded. They are needed before the commands run, so they are parsed from the
+// arguments directly.
+type Options struct {
+	ConfigFiles []string
+	Profile     string
+
+	// ValueType returns the schema type of the configuration value at a path,
+	// which environment variables for keys not in the configuration files are
+	// parsed as. Without it, such values are kept as text.
+	ValueType func(path []string) string
+}
+
+// ParseOptions reads the configuration flags from the command line arguments,
+// ignoring every other flag.
+func ParseOptions(args []string) Options {
+	options := Options{}
+
+	flags := pflag.NewFlagSet("config", pflag.ContinueOnError)
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	flags.SetOutput(io.Discard)
+	flags.StringArrayVar(&options.ConfigFiles, "config", nil, "")
+	flags.StringVar(&options.Profile, "profile", "", "")
+
+	// Errors (such as --help) are left for the commands to handle.
+	_ = flags.Parse(args)
+
+	if options.Profile == "" {
+		options.Profile = os.Getenv(ProfileEnv)
+	}
+
+	return options
+}
+
+// RegisterFlags adds the configuration flags to the command, so that they are
+// accepted by every command and listed in the help.
+func RegisterFlags(command *cobra.Command) {
+	command.PersistentFlags().StringArray("config", nil, "a configuration file to load (can be repeated, later files override earlier ones)")
+	command.PersistentFlags().String("profile", "", "the configuration profile to merge over the configuration (or set "+ProfileEnv+")")
+}
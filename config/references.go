@@ -0,0 +1,192 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// envPattern matches ${VAR} and ${VAR:-default}. A reference written as
+// $${VAR} is escaped and kept as ${VAR}.
+var envPattern = regexp.MustCompile(`\$(\$?)\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// minRedactedLength is the shortest resolved value that is redacted. Shorter
+// values (such as a port or a flag) would hide unrelated text.
+const minRedactedLength = 4
+
+// secrets holds the values resolved from env: and file: references, and the
+// secrets registered with AddSecret, which are redacted from logged output.
+var secrets = struct {
+	sync.RWMutex
+	values map[string]bool
+}{values: map[string]bool{}}
+
+// resolveReferences replaces the environment and file references in every
+// string value of the configuration. Relative file paths are relative to dir.
+func resolveReferences(v *viper.Viper, dir string) error {
+	for key, value := range v.AllSettings() {
+		resolved, changed, err := resolveValue(dir, key, value)
+		if err != nil {
+			return err
+		}
+		if changed {
+			v.Set(key, resolved)
+		}
+	}
+	return nil
+}
+
+// fileReferences returns the paths of the files the file: references in value
+// refer to, relative to dir.
+func fileReferences(value any, dir string) []string {
+	var files []string
+	switch typed := value.(type) {
+	case string:
+		if file, ok := strings.CutPrefix(typed, "file:"); ok {
+			files = append(files, resolvePath(dir, file))
+		}
+	case map[string]any:
+		for _, item := range typed {
+			files = append(files, fileReferences(item, dir)...)
+		}
+	case []any:
+		for _, item := range typed {
+			files = append(files, fileReferences(item, dir)...)
+		}
+	}
+	return files
+}
+
+// resolveValue resolves the references in value, returning true if anything
+// was replaced.
+func resolveValue(dir string, path string, value any) (any, bool, error) {
+	switch typed := value.(type) {
+	case string:
+		return resolveString(dir, path, typed)
+	case map[string]any:
+		changed := false
+		for key, item := range typed {
+			resolved, itemChanged, err := resolveValue(dir, path+"."+key, item)
+			if err != nil {
+				return nil, false, err
+			}
+			if itemChanged {
+				typed[key] = resolved
+				changed = true
+			}
+		}
+		return typed, changed, nil
+	case []any:
+		changed := false
+		for i, item := range typed {
+			resolved, itemChanged, err := resolveValue(dir, fmt.Sprintf("%s.%d", path, i), item)
+			if err != nil {
+				return nil, false, err
+			}
+			if itemChanged {
+				typed[i] = resolved
+				changed = true
+			}
+		}
+		return typed, changed, nil
+	default:
+		return value, false, nil
+	}
+}
+
+// resolveString resolves a value that is entirely an env:NAME or file:PATH
+// reference, or otherwise interpolates the ${VAR} references within it. A
+// value starting with \env: or \file: is escaped and kept without the
+// backslash. Only the env: and file: values are redacted from logged output,
+// as interpolated variables usually hold settings rather than secrets.
+func resolveString(dir string, path string, value string) (string, bool, error) {
+
+	if strings.HasPrefix(value, `\env:`) || strings.HasPrefix(value, `\file:`) {
+		return value[1:], true, nil
+	}
+
+	if name, ok := strings.CutPrefix(value, "env:"); ok {
+		resolved, found := os.LookupEnv(name)
+		if !found {
+			return "", false, fmt.Errorf("%s: environment variable %s is not set", path, name)
+		}
+		AddSecret(resolved)
+		return resolved, true, nil
+	}
+
+	if file, ok := strings.CutPrefix(value, "file:"); ok {
+		content, err := os.ReadFile(resolvePath(dir, file))
+		if err != nil {
+			return "", false, fmt.Errorf("%s: failed to read %s: %w", path, file, err)
+		}
+		// Secret files usually end with a newline.
+		resolved := strings.TrimSpace(string(content))
+		AddSecret(resolved)
+		return resolved, true, nil
+	}
+
+	if !strings.Contains(value, "${") {
+		return value, false, nil
+	}
+
+	var missing []string
+	resolved := envPattern.ReplaceAllStringFunc(value, func(reference string) string {
+		match := envPattern.FindStringSubmatch(reference)
+		if match[1] != "" {
+			return reference[1:]
+		}
+
+		// With a default, an empty variable is treated as missing.
+		env, found := os.LookupEnv(match[2])
+		if match[3] != "" && env == "" {
+			return match[4]
+		}
+		if found {
+			return env
+		}
+
+		missing = append(missing, match[2])
+		return ""
+	})
+
+	if len(missing) > 0 {
+		return "", false, fmt.Errorf("%s: environment variable %s is not set", path, strings.Join(missing, ", "))
+	}
+
+	return resolved, true, nil
+}
+
+// AddSecret registers a secret read outside the configuration, such as a
+// client secret read from a file, so that it is redacted from logged output.
+func AddSecret(value string) {
+	if len(value) < minRedactedLength {
+		return
+	}
+	secrets.Lock()
+	secrets.values[value] = true
+	secrets.Unlock()
+}
+
+// Redact replaces the configuration values resolved from the environment or
+// from files in text, so that secrets are not written to logs.
+func Redact(text string) string {
+	secrets.RLock()
+	values := make([]string, 0, len(secrets.values))
+	for value := range secrets.values {
+		values = append(values, value)
+	}
+	secrets.RUnlock()
+
+	// Replace longer values first, in case one secret contains another.
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	for _, value := range values {
+		text = strings.ReplaceAll(text, value, "[redacted]")
+	}
+	return text
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestResolveString(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "secret"), []byte("file secret value\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_REFERENCE_VALUE", "from env")
+	t.Setenv("TEST_REFERENCE_EMPTY", "")
+
+	tests := []struct {
+		value       string
+		want        string
+		wantChanged bool
+		wantErr     bool
+	}{
+		{value: "plain", want: "plain"},
+		{value: "env:TEST_REFERENCE_VALUE", want: "from env", wantChanged: true},
+		{value: "env:TEST_REFERENCE_EMPTY", want: "", wantChanged: true},
+		{value: "env:TEST_REFERENCE_UNSET", wantErr: true},
+		{value: "file:secret", want: "file secret value", wantChanged: true},
+		{value: "file:" + filepath.Join(dir, "secret"), want: "file secret value", wantChanged: true},
+		{value: "file:missing", wantErr: true},
+		{value: `\env:TEST_REFERENCE_VALUE`, want: "env:TEST_REFERENCE_VALUE", wantChanged: true},
+		{value: `\file:secret`, want: "file:secret", wantChanged: true},
+		{value: "a env:TEST_REFERENCE_VALUE", want: "a env:TEST_REFERENCE_VALUE"},
+		{value: "${TEST_REFERENCE_VALUE}", want: "from env", wantChanged: true},
+		{value: "x-${TEST_REFERENCE_VALUE}-y", want: "x-from env-y", wantChanged: true},
+		{value: "${TEST_REFERENCE_EMPTY}", want: "", wantChanged: true},
+		{value: "${TEST_REFERENCE_EMPTY:-default}", want: "default", wantChanged: true},
+		{value: "${TEST_REFERENCE_UNSET:-default}", want: "default", wantChanged: true},
+		{value: "${TEST_REFERENCE_UNSET:-}", want: "", wantChanged: true},
+		{value: "${TEST_REFERENCE_UNSET}", wantErr: true},
+		{value: "$${TEST_REFERENCE_VALUE}", want: "${TEST_REFERENCE_VALUE}", wantChanged: true},
+	}
+
+	for _, test := range tests {
+		got, changed, err := resolveString(dir, "key", test.value)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("resolveString(%q) = %q, want an error", test.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("resolveString(%q) returned error %v", test.value, err)
+			continue
+		}
+		if got != test.want || changed != test.wantChanged {
+			t.Errorf("resolveString(%q) = %q, %v, want %q, %v", test.value, got, changed, test.want, test.wantChanged)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	t.Setenv("TEST_REDACT_SECRET", "secret-value")
+	t.Setenv("TEST_REDACT_SETTING", "setting-value")
+	t.Setenv("TEST_REDACT_SHORT", "abc")
+
+	for _, value := range []string{"env:TEST_REDACT_SECRET", "${TEST_REDACT_SETTING}", "env:TEST_REDACT_SHORT"} {
+		if _, _, err := resolveString("", "key", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	AddSecret("secret-value-longer")
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "nothing to hide", want: "nothing to hide"},
+		{text: "password secret-value", want: "password [redacted]"},
+		{text: "secret-value-longer", want: "[redacted]"},
+		{text: "secret-value and secret-value", want: "[redacted] and [redacted]"},
+		{text: "setting-value", want: "setting-value"},
+		{text: "abc", want: "abc"},
+	}
+
+	for _, test := range tests {
+		if got := Redact(test.text); got != test.want {
+			t.Errorf("Redact(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestFileReferences(t *testing.T) {
+	settings := map[string]any{
+		"superuser": map[string]any{
+			"accounts": []any{
+				map[string]any{"email": "admin@example.com", "password": "file:secrets/admin"},
+				map[string]any{"password": "file:/run/secrets/ops"},
+			},
+		},
+		"smtp":  map[string]any{"password": "env:SMTP_PASSWORD", "host": "a file:name"},
+		"other": `\file:literal`,
+	}
+
+	files := fileReferences(settings, "/etc/app")
+	sort.Strings(files)
+
+	want := []string{"/etc/app/secrets/admin", "/run/secrets/ops"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("fileReferences() = %v, want %v", files, want)
+	}
+}
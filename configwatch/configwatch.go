@@ -0,0 +1,252 @@
+package configwatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/viper"
+
+	"pocketforge/collections"
+	"pocketforge/config"
+	"pocketforge/data"
+	"pocketforge/jsonschema"
+	"pocketforge/validation"
+)
+
+// debounceDelay is how long to wait after a change before reloading, as
+// editors often write a file in several steps.
+const debounceDelay = 500 * time.Millisecond
+
+// SetupConfigWatch watches the configuration files while the server is
+// running. When they change and the new configuration is valid, the server is
+// restarted so that every part of the configuration is applied. Invalid
+// changes are logged and the server keeps running with the previous
+// configuration.
+func SetupConfigWatch(app *pocketbase.PocketBase, v *viper.Viper, options config.Options, sources config.Sources) {
+
+	if !v.GetBool("settings.restart_on_config_change") {
+		return
+	}
+
+	app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+		watcher, err := watchConfig(app, v, options, sources)
+		if err != nil {
+			return fmt.Errorf("failed to watch the configuration: %w", err)
+		}
+
+		app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+			watcher.Close()
+			return e.Next()
+		})
+
+		return e.Next()
+	})
+}
+
+func watchConfig(app core.App, v *viper.Viper, options config.Options, sources config.Sources) (*fsnotify.Watcher, error) {
+
+	referenced := referencedFiles(v, sources)
+
+	current, err := snapshot(v, referenced)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(sources.Files)+len(referenced))
+	for _, file := range sources.Files {
+		files = append(files, filepath.Clean(file))
+	}
+	directory := filepath.Clean(sources.ConfigDirectory())
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	// The directories are watched, as editors often replace a file rather than
+	// writing to it. The config.d directory is watched (if it exists) so that
+	// new files are picked up.
+	directories := []string{directory}
+	for _, file := range files {
+		if !slices.Contains(directories, filepath.Dir(file)) {
+			directories = append(directories, filepath.Dir(file))
+		}
+	}
+	for _, watched := range directories {
+		if err := watcher.Add(watched); err != nil && watched != directory {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	// The files the configuration refers to are watched too. They are checked
+	// when the configuration is applied, so a missing directory is skipped.
+	for _, file := range referenced {
+		watchedDirectory := filepath.Dir(file)
+		if !slices.Contains(directories, watchedDirectory) {
+			if err := watcher.Add(watchedDirectory); err != nil {
+				log.Printf("Configuration watcher: %s is not watched: %v", file, err)
+				continue
+			}
+			directories = append(directories, watchedDirectory)
+		}
+		files = append(files, file)
+	}
+
+	var mutex sync.Mutex
+	var timer *time.Timer
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				name := filepath.Clean(event.Name)
+				inDirectory := filepath.Dir(name) == directory && config.IsConfigFile(name)
+				if !slices.Contains(files, name) && !inDirectory {
+					continue
+				}
+
+				mutex.Lock()
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(debounceDelay, func() {
+					mutex.Lock()
+					defer mutex.Unlock()
+					current = reload(app, options, current)
+				})
+				mutex.Unlock()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Configuration watcher error: %v", err)
+			}
+		}
+	}()
+
+	return watcher, nil
+}
+
+// reload loads and validates the changed configuration, and restarts the
+// server if it is valid and different. It returns the settings the server is
+// running with.
+func reload(app core.App, options config.Options, current []byte) []byte {
+
+	v, sources, err := config.LoadConfig(options)
+	if err != nil {
+		log.Printf("The changed configuration was not applied: %v", config.Redact(err.Error()))
+		return current
+	}
+
+	if err := jsonschema.Validate(v); err != nil {
+		log.Printf("The changed configuration was not applied: %v", err)
+		return current
+	}
+
+	changed, err := snapshot(v, referencedFiles(v, sources))
+	if err != nil {
+		log.Printf("The changed configuration was not applied: %v", err)
+		return current
+	}
+
+	if bytes.Equal(changed, current) {
+		return current
+	}
+
+	// The server would fail to start with a configuration that cannot be
+	// applied, so the files it reads are checked, and the collections are
+	// applied in a transaction that is rolled back. The transaction includes
+	// the seed records and renamed select values, and other writes to the
+	// database wait until it is rolled back.
+	if err := data.CheckImportFiles(v); err != nil {
+		log.Printf("The changed configuration was not applied: %v", config.Redact(err.Error()))
+		return current
+	}
+	if err := validation.CheckSchemaFiles(v); err != nil {
+		log.Printf("The changed configuration was not applied: %v", config.Redact(err.Error()))
+		return current
+	}
+	if _, err := collections.PlanCollections(app, v.Sub("collections")); err != nil {
+		log.Printf("The changed configuration was not applied: %v", config.Redact(err.Error()))
+		return current
+	}
+
+	log.Println("The configuration has changed, restarting")
+	if err := app.Restart(); err != nil {
+		log.Printf("Failed to restart: %v", err)
+		return current
+	}
+
+	return changed
+}
+
+// referencedFileKeys are the configuration keys whose values are the paths of
+// files read when the configuration is applied.
+var referencedFileKeys = []string{"client_secret_file", "values_file"}
+
+// referencedFiles returns the files the configuration refers to: the files
+// read with file: references, client secret files and select values files.
+func referencedFiles(v *viper.Viper, sources config.Sources) []string {
+	var files []string
+	for _, file := range sources.References {
+		files = append(files, filepath.Clean(file))
+	}
+
+	var find func(value any)
+	find = func(value any) {
+		switch typed := value.(type) {
+		case map[string]any:
+			for key, item := range typed {
+				if path, ok := item.(string); ok && path != "" && slices.Contains(referencedFileKeys, key) {
+					files = append(files, filepath.Clean(config.ResolvePath(path)))
+					continue
+				}
+				find(item)
+			}
+		case []any:
+			for _, item := range typed {
+				find(item)
+			}
+		case []map[string]any:
+			for _, item := range typed {
+				find(item)
+			}
+		}
+	}
+	find(v.AllSettings())
+
+	slices.Sort(files)
+	return slices.Compact(files)
+}
+
+// snapshot returns the settings along with the contents of the referenced
+// files, so that a change to either is detected. Files that cannot be read are
+// left out, as they are reported when the configuration is applied.
+func snapshot(v *viper.Viper, referenced []string) ([]byte, error) {
+	contents := map[string]string{}
+	for _, file := range referenced {
+		if content, err := os.ReadFile(file); err == nil {
+			contents[file] = string(content)
+		}
+	}
+
+	return json.Marshal(map[string]any{
+		"settings": v.AllSettings(),
+		"files":    contents,
+	})
+}
@@ -0,0 +1,241 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"pocketforge/config"
+)
+
+// ImportConfig is a CSV file loaded into a collection on startup. Without a
+// key the file is only imported while the collection is empty. With a key,
+// existing records with the same key are updated on every start.
+type ImportConfig struct {
+	Collection string `mapstructure:"collection" json:"collection"`
+	File       string `mapstructure:"file" json:"file"`
+	Key        string `mapstructure:"key" json:"key,omitempty"`
+	Separator  string `mapstructure:"separator" json:"separator,omitempty"`
+	ClearEmpty bool   `mapstructure:"clear_empty" json:"clear_empty,omitempty"`
+}
+
+// errDryRun is returned from the import transaction to discard every change.
+var errDryRun = errors.New("data import dry run")
+
+// SetupData adds the data import and export commands, and loads the configured
+// CSV files on startup.
+func SetupData(app *pocketbase.PocketBase, vAll *viper.Viper) {
+
+	importCommand := &cobra.Command{
+		Use:   "import",
+		Short: "Import data into collections",
+	}
+	importCommand.AddCommand(newImportCSVCommand(app))
+	app.RootCmd.AddCommand(importCommand)
+
+	exportCommand := &cobra.Command{
+		Use:   "export",
+		Short: "Export data from collections",
+	}
+	exportCommand.AddCommand(newExportDataCommand(app))
+	app.RootCmd.AddCommand(exportCommand)
+
+	v := vAll.Sub("data")
+
+	if v == nil || !v.IsSet("import") {
+		return
+	}
+
+	app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+		var imports []ImportConfig
+		if err := v.UnmarshalKey("import", &imports); err != nil {
+			return fmt.Errorf("failed to read the data import configuration: %w", err)
+		}
+
+		for _, importConfig := range imports {
+			if err := loadImport(app, importConfig); err != nil {
+				return fmt.Errorf("failed to import %s into %s: %w", importConfig.File, importConfig.Collection, err)
+			}
+		}
+
+		return e.Next()
+	})
+}
+
+// CheckImportFiles checks that the configured CSV files exist, without
+// importing them.
+func CheckImportFiles(vAll *viper.Viper) error {
+	var imports []ImportConfig
+	if err := vAll.UnmarshalKey("data.import", &imports); err != nil {
+		return fmt.Errorf("failed to read the data import configuration: %w", err)
+	}
+
+	for _, importConfig := range imports {
+		if _, err := os.Stat(config.ResolvePath(importConfig.File)); err != nil {
+			return fmt.Errorf("data import file %s not found", importConfig.File)
+		}
+	}
+
+	return nil
+}
+
+func loadImport(app core.App, importConfig ImportConfig) error {
+
+	if importConfig.Key == "" {
+		count, err := app.CountRecords(importConfig.Collection)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+	}
+
+	result, err := importFile(app, importConfig.Collection, config.ResolvePath(importConfig.File), ImportOptions{
+		Key:        importConfig.Key,
+		Separator:  importConfig.Separator,
+		ClearEmpty: importConfig.ClearEmpty,
+	}, false)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Imported %s into %s: %d created, %d updated", importConfig.File, importConfig.Collection, result.Created, result.Updated)
+	return nil
+}
+
+// importFile imports a CSV file into the collection within a transaction. If
+// any row fails nothing is imported. When dryRun is set the transaction is
+// always rolled back.
+func importFile(app core.App, collectionName string, path string, options ImportOptions, dryRun bool) (*ImportResult, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if options.BaseDir == "" {
+		options.BaseDir = filepath.Dir(path)
+	}
+
+	var result *ImportResult
+	err = app.RunInTransaction(func(txApp core.App) error {
+		collection, err := txApp.FindCollectionByNameOrId(collectionName)
+		if err != nil {
+			return fmt.Errorf("collection %s not found", collectionName)
+		}
+
+		result, err = ImportCSV(txApp, collection, file, options)
+		if err != nil {
+			return err
+		}
+
+		if err := result.err(); err != nil {
+			return err
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func newImportCSVCommand(app core.App) *cobra.Command {
+	var options ImportOptions
+	var collectionName string
+	var dryRun bool
+
+	command := &cobra.Command{
+		Use:          "csv [file]",
+		Short:        "Import the rows of a CSV file, with a header row of field names, into a collection",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			result, err := importFile(app, collectionName, args[0], options, dryRun)
+			if err != nil {
+				return err
+			}
+
+			if dryRun {
+				fmt.Fprintf(cmd.OutOrStdout(), "Dry run, nothing was saved. ")
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%d created, %d updated.\n", result.Created, result.Updated)
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&collectionName, "collection", "", "the name or id of the collection to import into")
+	command.Flags().StringVar(&options.Key, "key", "", "the field used to find existing records to update")
+	command.Flags().StringVar(&options.Separator, "separator", "|", "the separator between multiple select, relation and file values")
+	command.Flags().StringVar(&options.BaseDir, "files-dir", "", "the directory file paths are relative to (defaults to the directory of the CSV file)")
+	command.Flags().BoolVar(&options.ClearEmpty, "clear-empty", false, "clear the fields of updated records for empty cells (by default empty cells keep the existing value)")
+	command.Flags().BoolVar(&dryRun, "dry-run", false, "check every row without saving anything")
+	command.MarkFlagRequired("collection")
+
+	return command
+}
+
+func newExportDataCommand(app core.App) *cobra.Command {
+	var options ExportOptions
+	var collectionName string
+	var outputPath string
+
+	command := &cobra.Command{
+		Use:          "data",
+		Short:        "Export the records of a collection as CSV, JSON or NDJSON",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			collection, err := app.FindCollectionByNameOrId(collectionName)
+			if err != nil {
+				return fmt.Errorf("collection %s not found", collectionName)
+			}
+
+			output := cmd.OutOrStdout()
+			if outputPath != "" {
+				file, err := os.Create(outputPath)
+				if err != nil {
+					return fmt.Errorf("failed to create %s: %w", outputPath, err)
+				}
+				defer file.Close()
+				output = file
+			}
+
+			count, err := ExportRecords(app, collection, output, options)
+			if err != nil {
+				return err
+			}
+
+			if outputPath != "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "Exported %d records to %s\n", count, outputPath)
+			}
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&collectionName, "collection", "", "the name or id of the collection to export")
+	command.Flags().StringVar(&options.Format, "format", ExportFormatCSV, "the output format (csv, json or ndjson)")
+	command.Flags().StringVar(&options.Filter, "filter", "", "a PocketBase filter selecting the records to export")
+	command.Flags().StringVar(&options.Sort, "sort", "", "a PocketBase sort expression (defaults to id)")
+	command.Flags().StringSliceVar(&options.Expand, "expand", nil, "relations to expand, as in the API expand parameter")
+	command.Flags().StringVar(&options.Separator, "separator", "|", "the separator between multiple select, relation and file values in CSV files")
+	command.Flags().StringVarP(&outputPath, "output", "o", "", "the file to write to (defaults to stdout)")
+	command.MarkFlagRequired("collection")
+
+	return command
+}
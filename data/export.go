@@ -0,0 +1,267 @@
+package data
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatJSON   = "json"
+	ExportFormatNDJSON = "ndjson"
+)
+
+// exportBatchSize is the number of records loaded at a time, so that large
+// collections are streamed rather than loaded into memory.
+const exportBatchSize = 500
+
+// ExportOptions controls which records are exported and how they are written.
+type ExportOptions struct {
+	Format string
+
+	// Filter and Sort use the PocketBase filter and sort syntax.
+	Filter string
+	Sort   string
+
+	// Expand lists the relations to expand, as in the API expand parameter.
+	Expand []string
+
+	// Separator joins the values of multiple select, relation and file fields
+	// in CSV files.
+	Separator string
+}
+
+// recordWriter writes exported records in one of the export formats.
+type recordWriter interface {
+	write(record *core.Record) error
+	close() error
+}
+
+// ExportRecords writes the records of the collection matching the filter,
+// returning the number of records written. Hidden fields are not exported.
+func ExportRecords(app core.App, collection *core.Collection, writer io.Writer, options ExportOptions) (int, error) {
+
+	if options.Separator == "" {
+		options.Separator = "|"
+	}
+
+	filter := options.Filter
+	if filter == "" {
+		filter = `id != ""`
+	}
+
+	sortBy := options.Sort
+	if sortBy == "" {
+		sortBy = "id"
+	}
+
+	var output recordWriter
+	switch options.Format {
+	case ExportFormatCSV, "":
+		output = newCSVRecordWriter(writer, collection, options)
+	case ExportFormatJSON:
+		output = &jsonRecordWriter{writer: writer}
+	case ExportFormatNDJSON:
+		output = &ndjsonRecordWriter{encoder: json.NewEncoder(writer)}
+	default:
+		return 0, fmt.Errorf("unsupported export format %s", options.Format)
+	}
+
+	count := 0
+	for offset := 0; ; offset += exportBatchSize {
+		records, err := app.FindRecordsByFilter(collection, filter, sortBy, exportBatchSize, offset)
+		if err != nil {
+			return count, fmt.Errorf("failed to find records: %w", err)
+		}
+
+		if len(options.Expand) > 0 {
+			failed := app.ExpandRecords(records, options.Expand, nil)
+			for _, expand := range options.Expand {
+				if err, ok := failed[expand]; ok {
+					return count, fmt.Errorf("failed to expand %s: %w", expand, err)
+				}
+			}
+		}
+
+		for _, record := range records {
+			record.IgnoreEmailVisibility(true)
+			if err := output.write(record); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if len(records) < exportBatchSize {
+			break
+		}
+	}
+
+	return count, output.close()
+}
+
+type jsonRecordWriter struct {
+	writer  io.Writer
+	started bool
+}
+
+func (output *jsonRecordWriter) write(record *core.Record) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	prefix := ",\n  "
+	if !output.started {
+		prefix = "[\n  "
+		output.started = true
+	}
+
+	if _, err := io.WriteString(output.writer, prefix); err != nil {
+		return err
+	}
+	_, err = output.writer.Write(raw)
+	return err
+}
+
+func (output *jsonRecordWriter) close() error {
+	if !output.started {
+		_, err := io.WriteString(output.writer, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(output.writer, "\n]\n")
+	return err
+}
+
+type ndjsonRecordWriter struct {
+	encoder *json.Encoder
+}
+
+func (output *ndjsonRecordWriter) write(record *core.Record) error {
+	return output.encoder.Encode(record)
+}
+
+func (output *ndjsonRecordWriter) close() error {
+	return nil
+}
+
+// csvRecordWriter writes a column for every visible field except the autodate
+// fields, in the same format read by ImportCSV, and an expand.<relation>
+// column with the expanded records as JSON for every expanded relation.
+type csvRecordWriter struct {
+	writer        *csv.Writer
+	fields        []string
+	expands       []string
+	separator     string
+	headerWritten bool
+}
+
+func newCSVRecordWriter(writer io.Writer, collection *core.Collection, options ExportOptions) *csvRecordWriter {
+
+	output := &csvRecordWriter{
+		writer:    csv.NewWriter(writer),
+		separator: options.Separator,
+	}
+
+	for _, field := range collection.Fields {
+		// Autodate fields are set on save and cannot be imported, so they are
+		// left out to keep the file importable.
+		if field.GetHidden() || field.Type() == core.FieldTypePassword || field.Type() == core.FieldTypeAutodate {
+			continue
+		}
+		output.fields = append(output.fields, field.GetName())
+	}
+
+	expands := map[string]bool{}
+	for _, expand := range options.Expand {
+		relation, _, _ := strings.Cut(expand, ".")
+		expands[relation] = true
+	}
+	for relation := range expands {
+		output.expands = append(output.expands, relation)
+	}
+	sort.Strings(output.expands)
+
+	return output
+}
+
+// writeHeader writes the header row before the first record, or on close so
+// that an empty export still has a header row.
+func (output *csvRecordWriter) writeHeader() error {
+	if output.headerWritten {
+		return nil
+	}
+	output.headerWritten = true
+
+	header := append([]string{}, output.fields...)
+	for _, relation := range output.expands {
+		header = append(header, "expand."+relation)
+	}
+	return output.writer.Write(header)
+}
+
+func (output *csvRecordWriter) write(record *core.Record) error {
+
+	if err := output.writeHeader(); err != nil {
+		return err
+	}
+
+	row := make([]string, 0, len(output.fields)+len(output.expands))
+	for _, name := range output.fields {
+		row = append(row, output.format(record.Get(name)))
+	}
+
+	expanded := record.Expand()
+	for _, relation := range output.expands {
+		value, ok := expanded[relation]
+		if !ok {
+			row = append(row, "")
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		row = append(row, string(raw))
+	}
+
+	return output.writer.Write(row)
+}
+
+func (output *csvRecordWriter) close() error {
+	if err := output.writeHeader(); err != nil {
+		return err
+	}
+	output.writer.Flush()
+	return output.writer.Error()
+}
+
+// format turns a field value into the text of a cell.
+func (output *csvRecordWriter) format(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []string:
+		return strings.Join(value, output.separator)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case types.DateTime:
+		if value.IsZero() {
+			return ""
+		}
+		return value.String()
+	case types.JSONRaw:
+		return string(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
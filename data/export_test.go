@@ -0,0 +1,73 @@
+package data
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func TestExportCSVRoundTrip(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	collection := core.NewBaseCollection("csv_round_trip")
+	collection.Fields.Add(
+		&core.TextField{Name: "title", Required: true},
+		&core.NumberField{Name: "count"},
+		&core.SelectField{Name: "tags", Values: []string{"a", "b", "c"}, MaxSelect: 3},
+		&core.AutodateField{Name: "created", OnCreate: true},
+		&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+	)
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, title := range []string{"first", "second"} {
+		record := core.NewRecord(collection)
+		record.Set("title", title)
+		record.Set("count", 2)
+		record.Set("tags", []string{"a", "c"})
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var exported bytes.Buffer
+	count, err := ExportRecords(app, collection, &exported, ExportOptions{Format: ExportFormatCSV})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("exported %d records, want 2", count)
+	}
+
+	// Importing by id updates the exported records in place.
+	result, err := ImportCSV(app, collection, bytes.NewReader(exported.Bytes()), ImportOptions{Key: "id"})
+	if err != nil {
+		t.Fatalf("the export could not be imported: %v", err)
+	}
+	if err := result.err(); err != nil {
+		t.Fatal(err)
+	}
+	if result.Updated != 2 || result.Created != 0 {
+		t.Fatalf("import gave %d created, %d updated, want 0 created, 2 updated", result.Created, result.Updated)
+	}
+
+	records, err := app.FindAllRecords(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		if record.GetInt("count") != 2 {
+			t.Errorf("record %s has count %d, want 2", record.Id, record.GetInt("count"))
+		}
+		if tags := record.GetStringSlice("tags"); len(tags) != 2 || tags[0] != "a" || tags[1] != "c" {
+			t.Errorf("record %s has tags %v, want [a c]", record.Id, tags)
+		}
+	}
+}
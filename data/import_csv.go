@@ -0,0 +1,299 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ImportOptions controls how CSV rows are imported into a collection.
+type ImportOptions struct {
+	// Key is the field used to find existing records to update. If empty,
+	// every row creates a new record.
+	Key string
+
+	// BaseDir is the directory that file field paths are relative to.
+	BaseDir string
+
+	// Separator splits the values of multiple select, relation and file fields.
+	Separator string
+
+	// ClearEmpty clears the fields of updated records for empty cells. By
+	// default empty cells are skipped, so the field keeps its existing value.
+	ClearEmpty bool
+}
+
+// RowError is the failure to import a single CSV row. Rows are numbered as in
+// a spreadsheet, so the first row after the header is row 2.
+type RowError struct {
+	Row int
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// ImportResult counts the imported records and collects the rows that failed.
+type ImportResult struct {
+	Created int
+	Updated int
+	Errors  []*RowError
+}
+
+func (result *ImportResult) err() error {
+	if len(result.Errors) == 0 {
+		return nil
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%d row(s) could not be imported:", len(result.Errors))
+	for _, err := range result.Errors {
+		fmt.Fprintf(&builder, "\n  - %s", err)
+	}
+	return errors.New(builder.String())
+}
+
+// importColumn is a CSV column mapped to a collection field. Relation columns
+// can name the field of the related collection used to look up the related
+// records, with a "field:lookup" header (such as author:email).
+type importColumn struct {
+	field  core.Field
+	lookup string
+}
+
+// ImportCSV imports the rows of a CSV file with a header row of field names
+// into the collection. Every row is saved through app.Save, so record hooks
+// and validation apply, and every failed row is reported.
+func ImportCSV(app core.App, collection *core.Collection, reader io.Reader, options ImportOptions) (*ImportResult, error) {
+
+	if options.Separator == "" {
+		options.Separator = "|"
+	}
+
+	csvReader := csv.NewReader(reader)
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header row: %w", err)
+	}
+
+	columns, err := mapColumns(collection, header)
+	if err != nil {
+		return nil, err
+	}
+
+	keyColumn := -1
+	if options.Key != "" {
+		for i, column := range columns {
+			if column.field.GetName() == options.Key {
+				keyColumn = i
+			}
+		}
+		if keyColumn < 0 {
+			return nil, fmt.Errorf("the key field %s is not one of the columns", options.Key)
+		}
+	}
+
+	result := &ImportResult{}
+
+	for rowNumber := 2; ; rowNumber++ {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read row %d: %w", rowNumber, err)
+		}
+
+		created, err := importRow(app, collection, columns, row, keyColumn, options)
+		if err != nil {
+			result.Errors = append(result.Errors, &RowError{Row: rowNumber, Err: err})
+		} else if created {
+			result.Created++
+		} else {
+			result.Updated++
+		}
+	}
+
+	return result, nil
+}
+
+func mapColumns(collection *core.Collection, header []string) ([]importColumn, error) {
+
+	columns := make([]importColumn, 0, len(header))
+
+	for _, name := range header {
+		fieldName, lookup, _ := strings.Cut(strings.TrimSpace(name), ":")
+
+		field := collection.Fields.GetByName(fieldName)
+		if field == nil {
+			return nil, fmt.Errorf("column %s does not match a field of collection %s", name, collection.Name)
+		}
+
+		if field.Type() == core.FieldTypeAutodate {
+			return nil, fmt.Errorf("column %s is an autodate field, which cannot be imported", name)
+		}
+
+		if lookup != "" && field.Type() != core.FieldTypeRelation {
+			return nil, fmt.Errorf("column %s has a lookup field, but is not a relation", name)
+		}
+
+		columns = append(columns, importColumn{field: field, lookup: lookup})
+	}
+
+	return columns, nil
+}
+
+// importRow creates or updates the record for a row, returning true if the
+// record was created.
+func importRow(app core.App, collection *core.Collection, columns []importColumn, row []string, keyColumn int, options ImportOptions) (bool, error) {
+
+	var record *core.Record
+	if keyColumn >= 0 {
+		if strings.TrimSpace(row[keyColumn]) == "" {
+			return false, fmt.Errorf("the row has no %s", options.Key)
+		}
+
+		existing, err := app.FindFirstRecordByData(collection, options.Key, row[keyColumn])
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return false, err
+		}
+		record = existing
+	}
+
+	created := record == nil
+	if created {
+		record = core.NewRecord(collection)
+	}
+
+	for i, column := range columns {
+		// Empty cells are skipped, so the field keeps its default or existing
+		// value, unless ClearEmpty is set and the record already exists.
+		if strings.TrimSpace(row[i]) == "" {
+			if options.ClearEmpty && !created && column.field.GetName() != core.FieldNameId {
+				record.Set(column.field.GetName(), nil)
+			}
+			continue
+		}
+
+		value, err := column.convert(app, row[i], options)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", column.field.GetName(), err)
+		}
+		record.Set(column.field.GetName(), value)
+	}
+
+	if err := app.Save(record); err != nil {
+		return false, err
+	}
+
+	return created, nil
+}
+
+// convert turns the text of a cell into a value for the field.
+func (column importColumn) convert(app core.App, raw string, options ImportOptions) (any, error) {
+
+	switch field := column.field.(type) {
+	case *core.NumberField:
+		return strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	case *core.BoolField:
+		return strconv.ParseBool(strings.TrimSpace(raw))
+	case *core.DateField:
+		date, err := types.ParseDateTime(strings.TrimSpace(raw))
+		if err != nil || date.IsZero() {
+			return nil, fmt.Errorf("invalid date %s", raw)
+		}
+		return date, nil
+	case *core.JSONField:
+		var value any
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		return value, nil
+	case *core.SelectField:
+		if field.MaxSelect > 1 {
+			return splitValues(raw, options.Separator), nil
+		}
+		return raw, nil
+	case *core.RelationField:
+		values := splitValues(raw, options.Separator)
+		if len(values) == 0 {
+			return nil, errors.New("no related records")
+		}
+		ids := []string{}
+		for _, value := range values {
+			id, err := column.lookupRelation(app, field, value)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		if field.MaxSelect > 1 {
+			return ids, nil
+		}
+		return ids[0], nil
+	case *core.FileField:
+		paths := splitValues(raw, options.Separator)
+		if len(paths) == 0 {
+			return nil, errors.New("no files")
+		}
+		files := []*filesystem.File{}
+		for _, path := range paths {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(options.BaseDir, path)
+			}
+			file, err := filesystem.NewFileFromPath(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+			}
+			files = append(files, file)
+		}
+		if field.MaxSelect > 1 {
+			return files, nil
+		}
+		return files[0], nil
+	default:
+		return raw, nil
+	}
+}
+
+// lookupRelation returns the id of the related record, found by id or by the
+// column's lookup field.
+func (column importColumn) lookupRelation(app core.App, field *core.RelationField, value string) (string, error) {
+
+	if column.lookup == "" || column.lookup == "id" {
+		return value, nil
+	}
+
+	related, err := app.FindFirstRecordByData(field.CollectionId, column.lookup, value)
+	if err != nil {
+		return "", fmt.Errorf("no related record with %s %s", column.lookup, value)
+	}
+
+	return related.Id, nil
+}
+
+func splitValues(raw string, separator string) []string {
+	var values []string
+	for _, value := range strings.Split(raw, separator) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
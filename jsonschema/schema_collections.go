@@ -2,10 +2,15 @@ package jsonschema
 
 import (
 	"embed"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
 
 	"github.com/spf13/viper"
 	"github.com/xeipuuv/gojsonschema"
+
+	"pocketforge/config"
 )
 
 //go:embed schema/**
@@ -23,6 +28,7 @@ func BuildSchema() (*gojsonschema.Schema, error) {
 	superusers_schema_location := "superuser/superuser_schema.json"
 	validation_schema_location := "validation/validation_schema.json"
 	settings_schema_location := "settings/settings_schema.json"
+	data_schema_location := "data/data_schema.json"
 
 	var schemaConfig = SchemaDefinition{
 		CoreSchema: SingleSchema{
@@ -44,6 +50,10 @@ func BuildSchema() (*gojsonschema.Schema, error) {
 					Ref: settings_schema_location,
 					Id:  resultPrefix + settings_schema_location,
 				},
+				{
+					Ref: data_schema_location,
+					Id:  resultPrefix + data_schema_location,
+				},
 			},
 		},
 		OtherSchema: []SingleSchema{
@@ -80,6 +90,10 @@ func BuildSchema() (*gojsonschema.Schema, error) {
 				Filename:     "schema/" + settings_schema_location,
 				Replacements: []SchemaReplacement{},
 			},
+			{
+				Filename:     "schema/" + data_schema_location,
+				Replacements: []SchemaReplacement{},
+			},
 		},
 	}
 
@@ -92,29 +106,41 @@ func BuildSchema() (*gojsonschema.Schema, error) {
 
 }
 
-func BuildSchemaAndValidate(v *viper.Viper) {
+// Validate checks the configuration against the configuration schema, and
+// returns an error listing every problem found.
+func Validate(v *viper.Viper) error {
 	schema, err := BuildSchema()
 	if err != nil {
-		log.Fatalf("Failed to build schema: %v", err)
+		return fmt.Errorf("failed to build schema: %w", err)
 	}
 
 	var genericConfig map[string]interface{}
 	err = v.UnmarshalExact(&genericConfig)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to read configuration: %w", err)
 	}
 	data := gojsonschema.NewStringLoader(SchemaToString(genericConfig))
 
 	result, err := schema.Validate(data)
 	if err != nil {
-		log.Panicf("Failed to validate collection schema: %v", err)
+		return fmt.Errorf("failed to validate configuration: %w", err)
 	}
 
 	if !result.Valid() {
-		log.Println("The configuration schema is not valid")
+		var builder strings.Builder
+		builder.WriteString("The configuration schema is not valid")
 		for _, desc := range result.Errors() {
-			log.Printf("- %s\n", desc)
+			fmt.Fprintf(&builder, "\n- %s", config.Redact(desc.String()))
 		}
+		return errors.New(builder.String())
+	}
+
+	return nil
+}
+
+func BuildSchemaAndValidate(v *viper.Viper) {
+	if err := Validate(v); err != nil {
+		log.Println(err)
 		log.Panic("The configuration schema is not valid")
 	}
 
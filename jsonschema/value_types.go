@@ -0,0 +1,125 @@
+package jsonschema
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxSchemaDepth limits how many references and combinations are followed, in
+// case a definition refers to itself.
+const maxSchemaDepth = 32
+
+// ValueType returns the schema type (such as "boolean", "integer", "number",
+// "array" or "string") of the configuration value at the path, or "" if the
+// schema does not give one. Numeric path segments are list indexes. It is used
+// to parse environment variables for keys that are not in the configuration
+// files.
+func ValueType(keys []string) string {
+	schemas := map[string]map[string]any{}
+	load := func(file string) map[string]any {
+		if _, ok := schemas[file]; !ok {
+			schemas[file] = LoadSchemaToJSON(file, &content)
+		}
+		return schemas[file]
+	}
+
+	var valueType func(file string, node map[string]any, keys []string, depth int) string
+	valueType = func(file string, node map[string]any, keys []string, depth int) string {
+		if node == nil || depth > maxSchemaDepth {
+			return ""
+		}
+
+		if ref, ok := node["$ref"].(string); ok {
+			refFile, pointer, _ := strings.Cut(ref, "#")
+			if refFile != "" {
+				file = path.Join(path.Dir(file), refFile)
+			}
+			return valueType(file, schemaPointer(load(file), pointer), keys, depth+1)
+		}
+
+		if len(keys) == 0 {
+			if nodeType := schemaNodeType(node); nodeType != "" {
+				return nodeType
+			}
+		} else if child := schemaChild(node, keys[0]); child != nil {
+			if childType := valueType(file, child, keys[1:], depth+1); childType != "" {
+				return childType
+			}
+		}
+
+		for _, combination := range []string{"allOf", "anyOf", "oneOf"} {
+			branches, _ := node[combination].([]any)
+			for _, branch := range branches {
+				branchNode, _ := branch.(map[string]any)
+				if branchType := valueType(file, branchNode, keys, depth+1); branchType != "" {
+					return branchType
+				}
+			}
+		}
+
+		return ""
+	}
+
+	return valueType("schema/config_schema.json", load("schema/config_schema.json"), keys, 0)
+}
+
+// schemaChild returns the schema of a property or list item of node.
+// Configuration keys are lowercased, so properties are matched without case.
+func schemaChild(node map[string]any, key string) map[string]any {
+	if _, err := strconv.Atoi(key); err == nil {
+		items, _ := node["items"].(map[string]any)
+		return items
+	}
+
+	properties, _ := node["properties"].(map[string]any)
+	for name, property := range properties {
+		if strings.EqualFold(name, key) {
+			child, _ := property.(map[string]any)
+			return child
+		}
+	}
+
+	additional, _ := node["additionalProperties"].(map[string]any)
+	return additional
+}
+
+// schemaNodeType returns the type of node. When several types are allowed and
+// one of them is a string, the value is kept as a string.
+func schemaNodeType(node map[string]any) string {
+	switch nodeType := node["type"].(type) {
+	case string:
+		return nodeType
+	case []any:
+		first := ""
+		for _, item := range nodeType {
+			name, _ := item.(string)
+			if name == "string" {
+				return name
+			}
+			if first == "" && name != "null" {
+				first = name
+			}
+		}
+		return first
+	default:
+		return ""
+	}
+}
+
+// schemaPointer returns the node at a JSON pointer (such as
+// /definitions/rules) within the schema.
+func schemaPointer(schema map[string]any, pointer string) map[string]any {
+	node := schema
+	for _, key := range strings.Split(strings.Trim(pointer, "/"), "/") {
+		if key == "" {
+			continue
+		}
+		child, ok := node[key].(map[string]any)
+		if !ok {
+			return nil
+		}
+		node = child
+	}
+	return node
+}
@@ -0,0 +1,33 @@
+package jsonschema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValueType(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "validation.enabled", want: "boolean"},
+		{path: "settings.hooks_dir", want: "string"},
+		{path: "settings.hooks_pool_size", want: "integer"},
+		{path: "superuser.accounts", want: "array"},
+		{path: "superuser.accounts.0.password", want: "string"},
+		{path: "collections.retain_collections", want: "array"},
+		{path: "collections.collections.0.fields.0.required", want: "boolean"},
+		{path: "collections.collections.0.fields.0.max", want: "number"},
+		{path: "collections.collections.0.auth.auth_alert.enabled", want: "boolean"},
+		{path: "data.import.0.clear_empty", want: "boolean"},
+		{path: "Validation.Enabled", want: "boolean"},
+		{path: "unknown", want: ""},
+		{path: "settings.unknown", want: ""},
+	}
+
+	for _, test := range tests {
+		if got := ValueType(strings.Split(test.path, ".")); got != test.want {
+			t.Errorf("ValueType(%s) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
@@ -15,6 +15,8 @@ import (
 
 	"pocketforge/collections"
 	"pocketforge/config" //Import the new config package
+	"pocketforge/configwatch"
+	"pocketforge/data"
 	"pocketforge/jsonschema"
 	"pocketforge/superuser"
 	"pocketforge/validation" // Import the new validation package
@@ -27,10 +29,14 @@ func main() {
 	})
 
 	// Load configuration
-	v, err := config.LoadConfig()
+	config.RegisterFlags(app.RootCmd)
+	options := config.ParseOptions(os.Args[1:])
+	options.ValueType = jsonschema.ValueType
+	v, sources, err := config.LoadConfig(options)
 	if err != nil {
 		log.Fatalf("Error loading config: %v", err)
 	}
+	config.SetConfigDir(sources.Dir)
 
 	// Validate configuration
 	jsonschema.BuildSchemaAndValidate(v)
@@ -74,6 +80,8 @@ func main() {
 	validation.ConfigureSchemaValidation(app, v)
 	superuser.ConfigureSuperuserOverrides(app, v)
 	collections.SetupConfiguredCollections(app, v)
+	data.SetupData(app, v)
+	configwatch.SetupConfigWatch(app, v, options, sources)
 
 	if err := app.Start(); err != nil {
 		log.Fatal(err)
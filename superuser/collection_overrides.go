@@ -40,7 +40,7 @@ func overrideCollections(app *pocketbase.PocketBase, v *viper.Viper) error {
 	return nil
 }
 
-func (override CollectionOverrides) ProcessCollectionOverride(app *pocketbase.PocketBase) error {
+func (override CollectionOverrides) ProcessCollectionOverride(app core.App) error {
 
 	if override.PreventCollectionUpdate {
 		app.OnCollectionUpdateRequest().BindFunc(func(e *core.CollectionRequestEvent) error {
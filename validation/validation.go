@@ -19,12 +19,14 @@ type SchemaConfig struct {
 	Filename   string `mapstructure:"filename"`
 }
 
-func ConfigureSchemaValidation(app *pocketbase.PocketBase, vAll *viper.Viper) {
+// validationSettings returns the validation settings with their defaults, or
+// nil if validation is not configured or is disabled.
+func validationSettings(vAll *viper.Viper) *viper.Viper {
 
 	v := vAll.Sub("validation")
 
 	if v == nil {
-		return
+		return nil
 	}
 
 	v.SetDefault("enabled", true)
@@ -32,10 +34,51 @@ func ConfigureSchemaValidation(app *pocketbase.PocketBase, vAll *viper.Viper) {
 	v.SetDefault("collection_name", "_schema")
 
 	if !v.GetBool("enabled") {
+		return nil
+	}
+
+	return v
+}
+
+// schemaFilePath returns the path of the schema file of a schema configuration.
+func schemaFilePath(v *viper.Viper, config SchemaConfig) string {
+	return v.GetString("schema_dir") + "/" + config.Filename
+}
+
+// CheckSchemaFiles checks that the configured schema files exist and are valid
+// JSON schemas, without applying them.
+func CheckSchemaFiles(vAll *viper.Viper) error {
+
+	v := validationSettings(vAll)
+	if v == nil {
+		return nil
+	}
+
+	var schemaConfigs []SchemaConfig
+	if err := v.UnmarshalKey("schema", &schemaConfigs); err != nil {
+		return fmt.Errorf("failed to read the validation schemas: %w", err)
+	}
+
+	for _, config := range schemaConfigs {
+		path := schemaFilePath(v, config)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return fmt.Errorf("schema file does not exist: %s", path)
+		}
+		if _, _, err := readAndValidateSchema(path); err != nil {
+			return fmt.Errorf("schema file %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+func ConfigureSchemaValidation(app *pocketbase.PocketBase, vAll *viper.Viper) {
+
+	v := validationSettings(vAll)
+	if v == nil {
 		return
 	}
 
-	schemaDir := v.GetString("schema_dir")
 	collectionName := v.GetString("collection_name")
 	var schemaConfigs []SchemaConfig
 	if err := v.UnmarshalKey("schema", &schemaConfigs); err != nil {
@@ -54,7 +97,7 @@ func ConfigureSchemaValidation(app *pocketbase.PocketBase, vAll *viper.Viper) {
 		}
 
 		for _, config := range schemaConfigs {
-			schemaPath := schemaDir + "/" + config.Filename
+			schemaPath := schemaFilePath(v, config)
 			if _, err := os.Stat(schemaPath); os.IsNotExist(err) {
 				return fmt.Errorf("schema file does not exist: %s", schemaPath)
 			}